@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend(t *testing.T) {
+	for _, backend := range []string{"poll", "uring"} {
+		t.Run(backend, func(t *testing.T) {
+			require := require.New(t)
+
+			running := exec.Command("sleep", "10")
+			require.NoError(running.Start())
+			defer running.Wait()
+			defer running.Process.Kill()
+			exits := exec.Command("sleep", "0.1")
+			require.NoError(exits.Start())
+			defer exits.Wait()
+			pid := strconv.Itoa(exits.Process.Pid)
+
+			cmd := exec.Command(waitnBin, "-backend", backend,
+				strconv.Itoa(running.Process.Pid), "l="+pid)
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if strings.Contains(stderr.String(), "not supported") {
+				t.Skip(stderr.String())
+			}
+			require.NoError(err, stderr.String())
+			require.Equal("l "+pid+"\n", string(out))
+			require.Empty(stderr.String())
+
+			// the backend is closed on timing out with pid files open
+			cmd = exec.Command(waitnBin, "-backend", backend, "-t", "50",
+				strconv.Itoa(running.Process.Pid))
+			stderr.Reset()
+			cmd.Stderr = &stderr
+			err = cmd.Run()
+			var exitErr *exec.ExitError
+			require.True(errors.As(err, &exitErr), err)
+			require.Equal(waitn.TIMEOUT_ERROR, exitErr.ExitCode())
+			require.Equal(waitn.TimeoutErr.Error()+"\n", stderr.String())
+		})
+	}
+
+	err := exec.Command(waitnBin, "-backend", "kqueue", "1").Run()
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), err)
+	require.Equal(t, waitn.INPUT_ERROR, exitErr.ExitCode())
+}
+
+// more pids than the limit on open files are polled beyond a window of pidfds
+func TestBackendFileLimit(t *testing.T) {
+	require := require.New(t)
+
+	exits := exec.Command("sleep", "0.5")
+	require.NoError(exits.Start())
+	defer exits.Wait()
+	pid := strconv.Itoa(exits.Process.Pid)
+	args := []string{"-c", `ulimit -n 64 && exec "$0" "$@"`, waitnBin, "-s"}
+	for i := 0; i < 200; i++ {
+		args = append(args, pid)
+	}
+
+	out, err := exec.Command("sh", args...).Output()
+	require.NoError(err)
+	require.Equal(strings.Repeat(pid+"\n", 200), string(out))
+
+	args[4] = "-backend=pidfd"
+	err = exec.Command("sh", args...).Run()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+}
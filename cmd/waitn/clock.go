@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"golang.org/x/sys/unix"
+)
+
+// clocks waitn clock reads, by name without the CLOCK_ prefix
+var clockIds = map[string]int32{
+	"BOOTTIME":         unix.CLOCK_BOOTTIME,
+	"MONOTONIC":        unix.CLOCK_MONOTONIC,
+	"MONOTONIC_RAW":    unix.CLOCK_MONOTONIC_RAW,
+	"MONOTONIC_COARSE": unix.CLOCK_MONOTONIC_COARSE,
+	"REALTIME":         unix.CLOCK_REALTIME,
+	"TAI":              unix.CLOCK_TAI,
+}
+
+// parse a clock name, in any case and with or without the CLOCK_ prefix
+func parseClock(s string) (int32, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "CLOCK_")
+	clock, ok := clockIds[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown clock: %v", s)
+	}
+	return clock, nil
+}
+
+// formats printed by waitn clock
+const (
+	CLOCK_FORMAT_NS      = "ns"
+	CLOCK_FORMAT_S       = "s"
+	CLOCK_FORMAT_RFC3339 = "rfc3339"
+)
+
+// format t, a time on a clock, given that clock's current time and the wall
+// clock's.  RFC3339 is the wall clock time of the same instant.
+func formatClockTime(t time.Duration, clockNow time.Duration, wallNow time.Time,
+	format string) string {
+	switch format {
+	case CLOCK_FORMAT_NS:
+		return strconv.FormatInt(int64(t), 10)
+	case CLOCK_FORMAT_S:
+		sign := ""
+		if t < 0 {
+			sign = "-"
+			t = -t
+		}
+		return fmt.Sprintf("%v%d.%09d", sign, t/time.Second, t%time.Second)
+	case CLOCK_FORMAT_RFC3339:
+		return wallNow.Add(t - clockNow).Format(time.RFC3339Nano)
+	}
+	panic(fmt.Sprintf("unknown clock format: %v", format))
+}
+
+// the time on a clock of an instant boot since boot on CLOCK_BOOTTIME, given
+// both clocks' current times.  Clocks that stop during suspend, such as
+// CLOCK_MONOTONIC, are offset by the time suspended so far.
+func bootToClock(boot time.Duration, bootNow time.Duration,
+	clockNow time.Duration) time.Duration {
+	return clockNow - (bootNow - boot)
+}
+
+// waitn clock [-clock <name>] [-format ns|s|rfc3339] [-of <pid>]
+func clock(args []string) {
+	fs := flag.NewFlagSet("clock", flag.ExitOnError)
+	clockId := int32(unix.CLOCK_BOOTTIME)
+	clockUsage := "the clock to read: BOOTTIME, MONOTONIC, MONOTONIC_RAW, MONOTONIC_COARSE, REALTIME, or TAI (default BOOTTIME)"
+	fs.Func("clock", clockUsage, func(s string) error {
+		var err error
+		clockId, err = parseClock(s)
+		return err
+	})
+	format := CLOCK_FORMAT_NS
+	formatUsage := "how to print the time: ns or s since the clock's epoch, or rfc3339 for the wall clock time (default ns)"
+	fs.Func("format", formatUsage, func(s string) error {
+		switch s {
+		case CLOCK_FORMAT_NS, CLOCK_FORMAT_S, CLOCK_FORMAT_RFC3339:
+			format = s
+			return nil
+		}
+		return fmt.Errorf("unknown format: %v", s)
+	})
+	ofUsage := "print the start time of this process instead of the current time"
+	of := fs.Int("of", 0, ofUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(
+			fs.Output(),
+			`print the time on a clock, or when a process started.
+Usage: waitn clock [-clock <name>] [-format ns|s|rfc3339] [-of <pid>]`)
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output())
+		fmt.Fprint(
+			fs.Output(),
+			`Clock names may be lower case or have the CLOCK_ prefix.  With -of the
+process's start time is read from /proc/<pid>/stat, in units of 1/CLK_TCK since
+boot on CLOCK_BOOTTIME, and converted to the clock.  Clocks that stop during
+suspend are converted using the time suspended so far.  A pid and its start
+time on CLOCK_BOOTTIME identify a process even if the pid is reused, as do the
+start times -timing prints.  -deadline accepts ns on CLOCK_BOOTTIME.
+
+If the process cannot be found waitn exits with 1.`)
+		fmt.Fprintln(fs.Output())
+	}
+	parseSubcommandFlags(fs, args)
+	if len(fs.Args()) > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+
+	// read once if the same clock, so that start times on it are exact
+	clockNow := proc.ClockTime(clockId)
+	bootNow := clockNow
+	if clockId != unix.CLOCK_BOOTTIME {
+		bootNow = proc.BootTime()
+	}
+	wallNow := time.Now()
+	t := clockNow
+	if *of != 0 {
+		stat, err := proc.ReadStat(*of)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "pid %v: no such process\n", *of)
+			os.Exit(waitn.PROCESS_NOT_FOUND_ERROR)
+		} else if err != nil {
+			panic(err)
+		}
+		start := time.Duration(stat.StartTime) * (time.Second / proc.CLK_TCK)
+		t = bootToClock(start, bootNow, clockNow)
+	}
+	fmt.Println(formatClockTime(t, clockNow, wallNow, format))
+}
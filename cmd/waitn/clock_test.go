@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseClock(t *testing.T) {
+	require := require.New(t)
+
+	for _, name := range []string{"MONOTONIC_RAW", "monotonic_raw", "CLOCK_MONOTONIC_RAW"} {
+		clock, err := parseClock(name)
+		require.NoError(err)
+		require.Equal(int32(unix.CLOCK_MONOTONIC_RAW), clock)
+	}
+	_, err := parseClock("CLOCK_")
+	require.Error(err)
+}
+
+func TestFormatClockTime(t *testing.T) {
+	require := require.New(t)
+
+	wallNow := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clockNow := 100 * time.Second
+	d := 90*time.Second + 5*time.Millisecond
+	require.Equal("90005000000", formatClockTime(d, clockNow, wallNow, CLOCK_FORMAT_NS))
+	require.Equal("90.005000000", formatClockTime(d, clockNow, wallNow, CLOCK_FORMAT_S))
+	require.Equal("-0.005000000",
+		formatClockTime(-5*time.Millisecond, clockNow, wallNow, CLOCK_FORMAT_S))
+	require.Equal("2024-01-02T03:03:55.005Z",
+		formatClockTime(d, clockNow, wallNow, CLOCK_FORMAT_RFC3339))
+
+	// 10s after boot, having been suspended for 3s since
+	require.Equal(7*time.Second,
+		bootToClock(10*time.Second, 20*time.Second, 17*time.Second))
+}
+
+func TestClock(t *testing.T) {
+	require := require.New(t)
+
+	before := proc.BootTime()
+	out, err := exec.Command(waitnBin, "clock").Output()
+	require.NoError(err)
+	ns, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	require.NoError(err)
+	require.GreaterOrEqual(time.Duration(ns), before)
+	require.LessOrEqual(time.Duration(ns), proc.BootTime())
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	pid := strconv.Itoa(cmd.Process.Pid)
+	start, err := proc.StartTime(cmd.Process.Pid)
+	require.NoError(err)
+
+	out, err = exec.Command(waitnBin, "clock", "-of", pid).Output()
+	require.NoError(err)
+	require.Equal(strconv.FormatInt(int64(start), 10)+"\n", string(out))
+
+	out, err = exec.Command(waitnBin, "clock", "-clock", "REALTIME",
+		"-format", "rfc3339", "-of", pid).Output()
+	require.NoError(err)
+	started, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
+	require.NoError(err)
+	require.WithinDuration(time.Now(), started, time.Minute)
+
+	var exitErr *exec.ExitError
+	err = exec.Command(waitnBin, "clock", "-of", strconv.Itoa(1<<30)).Run()
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.PROCESS_NOT_FOUND_ERROR, exitErr.ExitCode())
+	err = exec.Command(waitnBin, "clock", "-clock", "sundial").Run()
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+}
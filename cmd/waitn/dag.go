@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+)
+
+// waitn dag <file>
+func dag(args []string) {
+	fs := flag.NewFlagSet("dag", flag.ExitOnError)
+	failFastUsage := "once a task fails start no more and terminate those running"
+	failFast := fs.Bool("fail-fast", false, failFastUsage)
+	var timeout timeoutFlags
+	timeoutFlag(fs, &timeout, "Zero implies no timeout")
+	var json bool
+	jsonFlag(fs, &json)
+	var usage bool
+	usageFlag(fs, &usage)
+	backend := backendFlag(fs)
+	signals := signalsFlag(fs)
+	graceUsage := "time after SIGTERM to send SIGKILL when terminating tasks"
+	grace := fs.Duration("grace", 10*time.Second, graceUsage)
+	fs.Usage = func() {
+		fmt.Fprintln(
+			fs.Output(),
+			`run tasks once the tasks they depend on succeed.
+Usage: waitn dag [-fail-fast] [-json] [-usage] [-t <timeout>]
+                 [-backend <backend>] [-signals <signals>] [-grace <duration>]
+                 <file>`)
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output())
+		fmt.Fprint(
+			fs.Output(),
+			`<file>, or stdin if -, has a task per line:
+  <name> [<dep>...] : <command>
+The command is everything after the first colon and is run with sh -c.  Empty
+lines and lines starting with # are ignored.  For example:
+  fetch: ./fetch.sh
+  build fetch: make
+  lint fetch: make lint
+  test build: make test
+
+A task starts as soon as all its dependencies succeed.  Tasks depending on a
+failed task are skipped.  Without -fail-fast all other tasks still run.  On
+timeout or an interrupting signal, or with -fail-fast once a task fails, no
+further tasks start and running tasks are sent SIGTERM, then SIGKILL after
+-grace.
+
+Once all tasks finish a summary table of tasks is printed.  With -usage it
+includes each task's CPU time and peak RSS from its rusage.
+
+return values:
+0 - all tasks succeeded
+3 - some task failed or was skipped
+otherwise as waitn.`)
+		fmt.Fprintln(fs.Output())
+	}
+	parseSubcommandFlags(fs, args)
+	if len(fs.Args()) != 1 {
+		fs.Usage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	waitBackend := parseBackendOrExit(*backend)
+	handler := notifySignals(parseSignalsOrExit(*signals))
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(waitn.INPUT_ERROR)
+		}
+		defer f.Close()
+		r = f
+	}
+	tasks, err := waitn.ParseDAG(r)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(waitn.INPUT_ERROR)
+	}
+
+	ctx, ctxCancel := timeoutContext(timeout)
+	defer ctxCancel()
+	ctx, signalCancel := handler.watch(ctx, nil, false)
+	defer signalCancel()
+	results, exitErr := waitn.RunDAG(ctx, waitBackend, tasks, *failFast, *grace)
+
+	out := newPrinter(json, nil)
+	out.usage = usage
+	out.backend = waitBackend
+	out.printTasks(results)
+	exitIfError(out, exitErr)
+	for _, result := range results {
+		if result.Status != waitn.TASK_SUCCEEDED {
+			exitIfError(out, waitn.JobFailedErr)
+		}
+	}
+	out.exit(0)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestDAG(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command(waitnBin, "dag", "-json", "-")
+	cmd.Stdin = strings.NewReader("a: true\nb a: exit 2\nc b: true\n")
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.JOB_FAILED_ERROR, exitErr.ExitCode())
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(lines, 3)
+	require.Contains(lines[0], `"name":"a","status":"succeeded"`)
+	require.Contains(lines[1], `"name":"b","status":"failed"`)
+	require.Contains(lines[1], `"exitCode":2`)
+	require.Contains(lines[2], `"name":"c","status":"skipped"`)
+
+	cmd = exec.Command(waitnBin, "dag", "-")
+	cmd.Stdin = strings.NewReader("a b: true\nb a: true\n")
+	err = cmd.Run()
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+
+	cmd = exec.Command(waitnBin, "dag", "-backend", "poll", "-")
+	cmd.Stdin = strings.NewReader("a: true\nb a: true\n")
+	require.NoError(cmd.Run())
+
+	cmd = exec.Command(waitnBin, "dag", "-backend", "bogus", "-")
+	cmd.Stdin = strings.NewReader("a: true\n")
+	err = cmd.Run()
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+}
+
+// tasks started after waitn raised its limit on open files for pidfds start
+// with the soft limit waitn started with
+func TestDAGFileLimit(t *testing.T) {
+	require := require.New(t)
+
+	var lim unix.Rlimit
+	require.NoError(unix.Getrlimit(unix.RLIMIT_NOFILE, &lim))
+	if lim.Max < 512 {
+		t.Skip("hard limit on open files too low")
+	}
+	path := filepath.Join(t.TempDir(), "limit")
+	cmd := exec.Command("sh", "-c", fmt.Sprintf(
+		"ulimit -Sn 256; exec %v dag -", waitnBin))
+	cmd.Stdin = strings.NewReader(fmt.Sprintf(
+		"a: true\nb a: ulimit -Sn > %v\n", path))
+	require.NoError(cmd.Run())
+	limit, err := os.ReadFile(path)
+	require.NoError(err)
+	require.Equal("256", strings.TrimSpace(string(limit)))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUntilExec(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sh", "-c", "sleep 0.1; exec sleep 10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	pid := strconv.Itoa(cmd.Process.Pid)
+
+	out, err := exec.Command(waitnBin, "-until", "exec", "l="+pid).Output()
+	require.NoError(err)
+	require.Equal("l "+pid+" event=exec\n", string(out))
+
+	err = exec.Command(waitnBin, "-until", "fork", pid).Run()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sh", "-c", "sleep 0.2; exit 5")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+
+	var out, stderr bytes.Buffer
+	waitCmd := exec.Command(waitnBin, "-json", "-exit-code",
+		strconv.Itoa(cmd.Process.Pid))
+	waitCmd.Stdout = &out
+	waitCmd.Stderr = &stderr
+	require.NoError(waitCmd.Run())
+	var result map[string]any
+	require.NoError(json.Unmarshal(out.Bytes(), &result))
+	require.Equal(float64(cmd.Process.Pid), result["pid"])
+	if strings.HasPrefix(stderr.String(), "exit codes unavailable") {
+		// without CAP_NET_ADMIN waitn still waits using pidfds
+		require.NotContains(result, "exitCode")
+		t.Skip(stderr.String())
+	}
+	require.Empty(stderr.String())
+	require.Equal(float64(5), result["exitCode"])
+}
+
+func TestExitCodeNotFound(t *testing.T) {
+	require := require.New(t)
+
+	// pids that are gone before waitn starts have no exit to wait for
+	args := []string{"-s", "-exit-code"}
+	for i := 0; i < 5; i++ {
+		cmd := exec.Command("true")
+		require.NoError(cmd.Run())
+		args = append(args, strconv.Itoa(cmd.Process.Pid))
+	}
+	var out, stderr bytes.Buffer
+	waitCmd := exec.Command(waitnBin, args...)
+	waitCmd.Stdout = &out
+	waitCmd.Stderr = &stderr
+	start := time.Now()
+	require.NoError(waitCmd.Run())
+	elapsed := time.Since(start)
+	if strings.HasPrefix(stderr.String(), "exit codes unavailable") {
+		t.Skip(stderr.String())
+	}
+	require.Len(strings.Split(strings.TrimSpace(out.String()), "\n"), 5)
+	// each would otherwise wait 100ms for its exit to be reported
+	require.Less(elapsed, 400*time.Millisecond)
+}
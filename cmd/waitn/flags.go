@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"golang.org/x/sys/unix"
+)
+
+// flags shared by waitn and its subcommands
+
+func errorOnUnknownFlag(fs *flag.FlagSet, p *waitn.UnknownPolicy) {
+	errorOnUnknownUsage := "if any process cannot be found return an error code, not 0.  With =invisible only if it may exist but is not visible"
+	fs.Var((*unknownPolicyValue)(p), "error-on-unknown", errorOnUnknownUsage)
+	fs.Var((*unknownPolicyValue)(p), "u", "shorthand for -error-on-unknown")
+}
+
+// -error-on-unknown, a boolean flag that may also be =invisible
+type unknownPolicyValue waitn.UnknownPolicy
+
+func (v *unknownPolicyValue) IsBoolFlag() bool {
+	return true
+}
+
+func (v *unknownPolicyValue) String() string {
+	switch waitn.UnknownPolicy(*v) {
+	case waitn.UNKNOWN_ERROR:
+		return "true"
+	case waitn.UNKNOWN_INVISIBLE_ERROR:
+		return "invisible"
+	}
+	return "false"
+}
+
+func (v *unknownPolicyValue) Set(s string) error {
+	if s == "invisible" {
+		*v = unknownPolicyValue(waitn.UNKNOWN_INVISIBLE_ERROR)
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("expected a boolean or invisible: %v", s)
+	}
+	*v = unknownPolicyValue(waitn.UNKNOWN_OK)
+	if b {
+		*v = unknownPolicyValue(waitn.UNKNOWN_ERROR)
+	}
+	return nil
+}
+
+// -timeout and -deadline.  A nil deadline is none.
+type timeoutFlags struct {
+	timeout time.Duration
+	// -timeout was given, distinguishing an explicit zero from none
+	timeoutSet bool
+	deadline   *waitn.Deadline
+	// the clock the timeout is measured on.  The deadline is on its own clock.
+	clock waitn.TimeoutClock
+}
+
+// -timeout 0 was given, to poll once rather than wait
+func (f timeoutFlags) poll() bool {
+	return f.timeoutSet && f.timeout == 0
+}
+
+// zeroUsage describes a timeout of zero
+func timeoutFlag(fs *flag.FlagSet, p *timeoutFlags, zeroUsage string) {
+	timeoutUsage := "timeout as a `duration` such as 90s or 2m30s, or in ms if a bare number.  Negative implies no timeout.  " + zeroUsage
+	fs.Var((*timeoutValue)(p), "timeout", timeoutUsage)
+	fs.Var((*timeoutValue)(p), "t", "shorthand for -`timeout`")
+	deadlineUsage := "absolute `time` at which to time out: RFC3339 or @<unix seconds> on CLOCK_REALTIME, or ns since boot on CLOCK_BOOTTIME"
+	fs.Var((*deadlineValue)(p), "deadline", deadlineUsage)
+	p.clock = waitn.MonotonicClock
+	timeoutClockUsage := "the `clock` timing -timeout: monotonic, which stops while the system is suspended, or boottime, which does not (default monotonic)"
+	fs.Func("timeout-clock", timeoutClockUsage, func(s string) error {
+		clock, err := waitn.ParseTimeoutClock(s)
+		if err != nil {
+			return err
+		}
+		p.clock = clock
+		return nil
+	})
+}
+
+// a timeout given as a duration or, for compatibility, a number of ms
+type timeoutValue timeoutFlags
+
+func (v *timeoutValue) String() string {
+	return v.timeout.String()
+}
+
+func (v *timeoutValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if ms, msErr := strconv.ParseInt(s, 10, 64); msErr == nil {
+		d, err = time.Duration(ms)*time.Millisecond, nil
+	}
+	if err != nil {
+		return err
+	}
+	v.timeout = d
+	v.timeoutSet = true
+	return nil
+}
+
+type deadlineValue timeoutFlags
+
+func (v *deadlineValue) String() string {
+	switch {
+	case v.deadline == nil:
+		return ""
+	case v.deadline.Clock == unix.CLOCK_BOOTTIME:
+		return strconv.FormatInt(v.deadline.At.Nanoseconds(), 10)
+	}
+	return time.Unix(0, v.deadline.At.Nanoseconds()).Format(time.RFC3339Nano)
+}
+
+func (v *deadlineValue) Set(s string) error {
+	deadline, err := parseDeadline(s)
+	if err != nil {
+		return err
+	}
+	v.deadline = &deadline
+	return nil
+}
+
+// parse a deadline as RFC3339 or @<unix seconds> with optional fraction, both
+// on CLOCK_REALTIME, or ns since boot on CLOCK_BOOTTIME as printed by -timing
+func parseDeadline(s string) (waitn.Deadline, error) {
+	if ns, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return waitn.Deadline{Clock: unix.CLOCK_BOOTTIME, At: time.Duration(ns)}, nil
+	}
+	if unixSecs, found := strings.CutPrefix(s, "@"); found {
+		secs, err := strconv.ParseFloat(unixSecs, 64)
+		if err != nil {
+			return waitn.Deadline{}, fmt.Errorf("invalid unix time: %v", s)
+		}
+		return waitn.Deadline{Clock: unix.CLOCK_REALTIME,
+			At: time.Duration(secs * float64(time.Second))}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return waitn.Deadline{}, fmt.Errorf("invalid deadline: %v", s)
+	}
+	return waitn.Deadline{Clock: unix.CLOCK_REALTIME,
+		At: time.Duration(t.UnixNano())}, nil
+}
+
+func jsonFlag(fs *flag.FlagSet, p *bool) {
+	jsonUsage := "print each result as a JSON object on its own line"
+	fs.BoolVar(p, "json", false, jsonUsage)
+}
+
+func usageFlag(fs *flag.FlagSet, p *bool) {
+	usageUsage := "print the resource usage of each process: CPU time, peak RSS, page faults, and context switches"
+	fs.BoolVar(p, "usage", false, usageUsage)
+}
+
+// unparsed -restart, -max-restarts, and -backoff flags, to be parsed with
+// parseRestartPolicyOrExit
+type restartFlags struct {
+	mode        *string
+	maxRestarts *int
+	backoff     *string
+}
+
+func restartFlag(fs *flag.FlagSet) restartFlags {
+	restartUsage := "restart a command once it exits: no, on-failure, or always"
+	maxRestartsUsage := "restart a command at most this many times.  Negative for no limit"
+	backoffUsage := "<min>..<max> delay before restarting, doubling from min to max with each restart of a command"
+	return restartFlags{
+		mode:        fs.String("restart", string(waitn.RESTART_NO), restartUsage),
+		maxRestarts: fs.Int("max-restarts", -1, maxRestartsUsage),
+		backoff:     fs.String("backoff", "1s..30s", backoffUsage)}
+}
+
+func parseRestartPolicy(flags restartFlags) (waitn.RestartPolicy, error) {
+	policy := waitn.RestartPolicy{MaxRestarts: *flags.maxRestarts}
+	var err error
+	if policy.Mode, err = waitn.ParseRestartMode(*flags.mode); err != nil {
+		return policy, err
+	}
+	policy.MinBackoff, policy.MaxBackoff, err = waitn.ParseBackoff(*flags.backoff)
+	return policy, err
+}
+
+func parseRestartPolicyOrExit(flags restartFlags) waitn.RestartPolicy {
+	policy, err := parseRestartPolicy(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	return policy
+}
+
+// returns the unparsed backend, to be parsed with parseBackendOrExit
+func backendFlag(fs *flag.FlagSet) *string {
+	backendUsage := "how to wait for processes: pidfd, poll to poll /proc, uring to poll pidfds with io_uring, or auto to poll /proc only if pidfd_open is unavailable"
+	return fs.String("backend", "auto", backendUsage)
+}
+
+func parseBackendOrExit(s string) waitn.Backend {
+	backend, err := waitn.ParseBackend(s)
+	exitIfError(newPrinter(false, nil), err)
+	return backend
+}
+
+// returns the unparsed signals, to be parsed with parseSignalsOrExit
+func signalsFlag(fs *flag.FlagSet) *string {
+	signalsUsage := "comma separated signals that interrupt waiting, exiting 128 + the signal number.  Empty for none"
+	return fs.String("signals", "INT,TERM,HUP", signalsUsage)
+}
+
+func parseSignalsOrExit(s string) []syscall.Signal {
+	sigs, err := parseSignals(s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	return sigs
+}
+
+// parse a subcommand's flags, exiting with INPUT_ERROR on error.  flag.Usage
+// is set to the subcommand's usage.
+func parseSubcommandFlags(fs *flag.FlagSet, args []string) {
+	flag.Usage = fs.Usage
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(waitn.INPUT_ERROR)
+	}
+}
+
+// returns a context for waiting/timeout and a function to cancel that context
+// (should be deferred).  The context ends at the earlier of the timeout and
+// deadline, the timeout timed on the -timeout-clock and the deadline on its own
+// clock.  Exits with DEADLINE_PASSED_ERROR if the deadline has already passed,
+// before any process is checked or started.
+func timeoutContext(flags timeoutFlags) (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	var deadlineCancel context.CancelFunc = func() {}
+	if flags.deadline != nil {
+		if flags.deadline.Remaining() <= 0 {
+			exitIfError(newPrinter(false, nil), waitn.DeadlinePassedErr)
+		}
+		ctx, deadlineCancel = waitn.WithDeadline(ctx, *flags.deadline)
+	}
+	var timeoutCancel context.CancelFunc = func() {}
+	if flags.timeout > 0 {
+		ctx, timeoutCancel = waitn.WithClockTimeout(ctx, flags.clock, flags.timeout)
+	}
+	return ctx, func() {
+		timeoutCancel()
+		deadlineCancel()
+	}
+}
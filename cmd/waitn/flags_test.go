@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTimeoutValue(t *testing.T) {
+	require := require.New(t)
+
+	var v timeoutValue
+	require.False(timeoutFlags(v).poll())
+	for s, d := range map[string]time.Duration{
+		"1500":  1500 * time.Millisecond,
+		"-1":    -time.Millisecond,
+		"90s":   90 * time.Second,
+		"2m30s": 150 * time.Second,
+	} {
+		require.NoError(v.Set(s), s)
+		require.Equal(d, v.timeout, s)
+		require.False(timeoutFlags(v).poll())
+	}
+	require.NoError(v.Set("0"))
+	require.True(timeoutFlags(v).poll())
+	require.Error(v.Set("soon"))
+}
+
+func TestParseDeadline(t *testing.T) {
+	require := require.New(t)
+
+	d, err := parseDeadline("2024-01-02T15:04:05Z")
+	require.NoError(err)
+	require.Equal(waitn.Deadline{Clock: unix.CLOCK_REALTIME,
+		At: time.Duration(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC).UnixNano())}, d)
+
+	d, err = parseDeadline("@1700000000.5")
+	require.NoError(err)
+	require.Equal(waitn.Deadline{Clock: unix.CLOCK_REALTIME,
+		At: 1700000000*time.Second + 500*time.Millisecond}, d)
+
+	// ns since boot
+	d, err = parseDeadline(strconv.FormatInt(time.Hour.Nanoseconds(), 10))
+	require.NoError(err)
+	require.Equal(waitn.Deadline{Clock: unix.CLOCK_BOOTTIME, At: time.Hour}, d)
+
+	for _, s := range []string{"", "@x", "tomorrow", "2024-01-02"} {
+		_, err = parseDeadline(s)
+		require.Error(err, s)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	require := require.New(t)
+
+	pid := strconv.Itoa(os.Getpid())
+	var exitErr *exec.ExitError
+	for _, passed := range []string{"@1", "1"} {
+		err := exec.Command(waitnBin, "-deadline", passed, pid).Run()
+		require.True(errors.As(err, &exitErr), err)
+		require.Equal(waitn.DEADLINE_PASSED_ERROR, exitErr.ExitCode(), passed)
+	}
+
+	// each on its own clock: the wall clock and time since boot
+	for _, deadlineAfter := range []func(time.Duration) string{
+		func(d time.Duration) string {
+			return time.Now().Add(d).Format(time.RFC3339Nano)
+		},
+		func(d time.Duration) string {
+			return strconv.FormatInt((proc.BootTime() + d).Nanoseconds(), 10)
+		},
+	} {
+		start := time.Now()
+		deadline := deadlineAfter(100 * time.Millisecond)
+		err := exec.Command(waitnBin, "-deadline", deadline, "-t", "1m", pid).Run()
+		require.True(errors.As(err, &exitErr), err)
+		require.Equal(waitn.TIMEOUT_ERROR, exitErr.ExitCode(), deadline)
+		require.Less(time.Since(start), 5*time.Second)
+	}
+}
+
+func TestTimeoutClock(t *testing.T) {
+	require := require.New(t)
+
+	pid := strconv.Itoa(os.Getpid())
+	start := time.Now()
+	err := exec.Command(waitnBin,
+		"-timeout-clock", "boottime", "-t", "500ms", pid).Run()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.TIMEOUT_ERROR, exitErr.ExitCode())
+	require.GreaterOrEqual(time.Since(start), 400*time.Millisecond)
+	require.Less(time.Since(start), 5*time.Second)
+}
+
+func TestErrorOnUnknown(t *testing.T) {
+	require := require.New(t)
+
+	gone := strconv.Itoa(1 << 30)
+	out, err := exec.Command(waitnBin, "-u", gone).Output()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.PROCESS_NOT_FOUND_ERROR, exitErr.ExitCode())
+	require.Equal(gone+"\n", string(out))
+
+	// only processes that may exist are errors
+	out, err = exec.Command(waitnBin, "-json", "-error-on-unknown=invisible",
+		gone).Output()
+	require.NoError(err)
+	var result map[string]any
+	require.NoError(json.Unmarshal(out, &result))
+	require.Equal(string(waitn.PROCESS_GONE), result["state"])
+
+	// exited but not yet reaped
+	zombie := exec.Command("true")
+	require.NoError(zombie.Start())
+	defer zombie.Wait()
+	require.Eventually(func() bool {
+		state, err := proc.ReadState(zombie.Process.Pid)
+		return err == nil && state.State == proc.STATE_ZOMBIE
+	}, 5*time.Second, time.Millisecond)
+	out, err = exec.Command(waitnBin, "-json",
+		strconv.Itoa(zombie.Process.Pid)).Output()
+	require.NoError(err)
+	require.NoError(json.Unmarshal(out, &result))
+	require.Equal(string(waitn.PROCESS_ZOMBIE), result["state"])
+
+	// and in text with -state
+	out, err = exec.Command(waitnBin, "-state", "-s",
+		strconv.Itoa(zombie.Process.Pid), gone).Output()
+	require.NoError(err)
+	require.Equal(gone+" state=gone\n"+
+		strconv.Itoa(zombie.Process.Pid)+" state=zombie\n", string(out))
+}
+
+func TestPoll(t *testing.T) {
+	require := require.New(t)
+
+	running := exec.Command("sleep", "10")
+	require.NoError(running.Start())
+	defer running.Wait()
+	defer running.Process.Kill()
+	pid := strconv.Itoa(running.Process.Pid)
+
+	start := time.Now()
+	err := exec.Command(waitnBin, "-t", "0", pid).Run()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.TIMEOUT_ERROR, exitErr.ExitCode())
+	require.Less(time.Since(start), 5*time.Second)
+
+	// every pid that is done is printed
+	out, err := exec.Command(waitnBin, "-t", "0", pid, "a=1073741824", "1073741825").Output()
+	require.NoError(err)
+	require.Equal("a 1073741824\n1073741825\n", string(out))
+}
+
+func TestAllReady(t *testing.T) {
+	require := require.New(t)
+
+	running := exec.Command("sleep", "10")
+	require.NoError(running.Start())
+	defer running.Wait()
+	defer running.Process.Kill()
+	pid := strconv.Itoa(running.Process.Pid)
+
+	// every pid that cannot be found is printed, without waiting
+	start := time.Now()
+	out, err := exec.Command(waitnBin, "-all-ready", pid, "a=1073741824",
+		"1073741825").Output()
+	require.NoError(err)
+	require.Equal("a 1073741824\n1073741825\n", string(out))
+	require.Less(time.Since(start), 5*time.Second)
+
+	out, err = exec.Command(waitnBin, "-all-ready", "-u", pid, "1073741824",
+		"1073741825").Output()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.PROCESS_NOT_FOUND_ERROR, exitErr.ExitCode())
+	require.Equal("1073741824\n1073741825\n", string(out))
+
+	// otherwise every pid done once any is
+	exited := exec.Command("sleep", "0.1")
+	require.NoError(exited.Start())
+	out, err = exec.Command(waitnBin, "-all-ready", pid,
+		strconv.Itoa(exited.Process.Pid)).Output()
+	require.NoError(err)
+	require.Equal(strconv.Itoa(exited.Process.Pid)+"\n", string(out))
+	exited.Wait()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+)
+
+// waitn jobs [-j N] < commands
+func jobs(args []string) {
+	fs := flag.NewFlagSet("jobs", flag.ExitOnError)
+	limitUsage := "run at most this many commands at once"
+	limit := fs.Int("j", runtime.NumCPU(), limitUsage)
+	nulUsage := "commands are separated by NUL rather than newline"
+	nul := fs.Bool("0", false, nulUsage)
+	haltUsage := "once a command fails start no more and terminate those running"
+	halt := fs.Bool("halt-on-failure", false, haltUsage)
+	keepOrderUsage := "print results in input order rather than finish order"
+	keepOrder := fs.Bool("keep-order", false, keepOrderUsage)
+	var timeout timeoutFlags
+	timeoutFlag(fs, &timeout, "Zero implies no timeout")
+	var json bool
+	jsonFlag(fs, &json)
+	var usage bool
+	usageFlag(fs, &usage)
+	signals := signalsFlag(fs)
+	graceUsage := "time after SIGTERM to send SIGKILL when terminating commands"
+	grace := fs.Duration("grace", 10*time.Second, graceUsage)
+	restart := restartFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(
+			fs.Output(),
+			`run commands read from stdin with bounded parallelism.
+Usage: waitn jobs [-j <N>] [-0] [-halt-on-failure] [-keep-order] [-json]
+                  [-usage] [-t <timeout>] [-signals <signals>]
+                  [-grace <duration>] [-restart <mode>] [-max-restarts <N>]
+                  [-backoff <min>..<max>]`)
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output())
+		fmt.Fprint(
+			fs.Output(),
+			`Each line (or NUL separated string with -0) is a command run with sh -c.
+Empty commands are skipped.  Commands have stdin from /dev/null.  As each
+command finishes its input index (from 1), exit code, and command are printed.
+With -usage the command's rusage is printed as user=, sys=, maxrss_kib=,
+minflt=, majflt=, nvcsw=, and nivcsw= fields between the exit code and command.
+
+With -restart a command that exits is started again, with a new pid, after
+its backoff.  A restarted command keeps its place among the -j running
+commands.  Each restart is printed as the index, "restart", the exit code, and
+the command, or with "restarting":true in JSON.  Only a command's final exit
+counts as a failure.
+
+On timeout or an interrupting signal no further commands are started and those
+running are sent SIGTERM, then SIGKILL after -grace.  Commands waiting to
+restart are not restarted.
+
+return values:
+0 - all commands succeeded
+3 - some command failed
+otherwise as waitn.`)
+		fmt.Fprintln(fs.Output())
+	}
+	parseSubcommandFlags(fs, args)
+	if *limit < 1 || len(fs.Args()) > 0 {
+		fs.Usage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	policy := parseRestartPolicyOrExit(restart)
+	handler := notifySignals(parseSignalsOrExit(*signals))
+	ctx, ctxCancel := timeoutContext(timeout)
+	defer ctxCancel()
+	ctx, signalCancel := handler.watch(ctx, nil, false)
+	defer signalCancel()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if *nul {
+		scanner.Split(scanNul)
+	}
+	next := func() (string, bool) {
+		for scanner.Scan() {
+			if command := scanner.Text(); command != "" {
+				return command, true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintf(os.Stderr, "reading commands: %v\n", err)
+		}
+		return "", false
+	}
+
+	out := newPrinter(json, nil)
+	out.usage = usage
+	onResult := out.printJob
+	if *keepOrder {
+		onResult = inOrder(out.printJob)
+	}
+	failed, exitErr := waitn.RunJobs(
+		ctx, next, *limit, *halt, *grace, policy, onResult)
+	exitIfError(out, exitErr)
+	if failed > 0 {
+		exitIfError(out, waitn.JobFailedErr)
+	}
+	os.Exit(0)
+}
+
+// bufio.SplitFunc for NUL separated strings
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// returns a function passing results to f in index order, holding results until
+// all earlier commands' final results have been passed.  Restarts of a command
+// are passed along with its final result.
+func inOrder(f func(waitn.JobResult)) func(waitn.JobResult) {
+	held := make(map[int][]waitn.JobResult)
+	nextIndex := 1
+	return func(result waitn.JobResult) {
+		held[result.Index] = append(held[result.Index], result)
+		for {
+			results := held[nextIndex]
+			if len(results) == 0 || results[len(results)-1].Restarting {
+				return
+			}
+			delete(held, nextIndex)
+			nextIndex++
+			for _, result := range results {
+				f(result)
+			}
+		}
+	}
+}
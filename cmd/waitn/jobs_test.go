@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInOrder(t *testing.T) {
+	var indexes []int
+	f := inOrder(func(result waitn.JobResult) {
+		indexes = append(indexes, result.Index)
+	})
+	for _, index := range []int{3, 1, 4, 2} {
+		f(waitn.JobResult{Index: index})
+	}
+	require.Equal(t, []int{1, 2, 3, 4}, indexes)
+
+	// restarts are held with their command's final result
+	indexes = nil
+	f = inOrder(func(result waitn.JobResult) {
+		indexes = append(indexes, result.Index)
+	})
+	f(waitn.JobResult{Index: 1, Restarting: true})
+	f(waitn.JobResult{Index: 2})
+	require.Empty(t, indexes)
+	f(waitn.JobResult{Index: 1})
+	require.Equal(t, []int{1, 1, 2}, indexes)
+}
+
+func TestJobs(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command(waitnBin, "jobs", "-j", "2", "-0", "-keep-order")
+	cmd.Stdin = strings.NewReader("sleep 0.2; exit 1\x00sleep 0.1\x00\x00true")
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.JOB_FAILED_ERROR, exitErr.ExitCode())
+	require.Equal("1 1 sleep 0.2; exit 1\n2 0 sleep 0.1\n3 0 true\n", string(out))
+}
+
+func TestJobsRestart(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command(waitnBin, "jobs", "-restart", "on-failure",
+		"-max-restarts", "2", "-backoff", "10ms..20ms")
+	cmd.Stdin = strings.NewReader("exit 1\n")
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.JOB_FAILED_ERROR, exitErr.ExitCode())
+	require.Equal("1 restart 1 exit 1\n1 restart 1 exit 1\n1 1 exit 1\n", string(out))
+
+	cmd = exec.Command(waitnBin, "jobs", "-restart", "sometimes")
+	err = cmd.Run()
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+}
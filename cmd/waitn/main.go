@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/stevenpelley/waitn/internal/waitn"
@@ -12,28 +13,102 @@ import (
 
 // CLI flags
 type cliFlags struct {
-	errorOnUnknown bool
-	timeoutMs      int64
+	errorOnUnknown waitn.UnknownPolicy
+	timeout        timeoutFlags
+	json           bool
+	stream         bool
+	allReady       bool
+	timing         bool
+	usage          bool
+	thread         bool
+	pidns          string
+	labels         []string
+	exitCode       bool
+	state          bool
+	until          waitn.Event
+	backend        waitn.Backend
+	signals        []syscall.Signal
+	forward        bool
+	parent         bool
+	pgrp           int
+	pgrpSignal     syscall.Signal
 }
 
 // returns a context for waiting/timeout, a function to cancel that context
-// (should be deferred), and flags from the CLI
-func prepare() (context.Context, context.CancelFunc, cliFlags) {
+// (should be deferred), flags from the CLI, and a handler catching interrupting
+// signals
+func prepare() (context.Context, context.CancelFunc, cliFlags, *signalHandler) {
 	cliFlags := cliFlags{}
 
-	errorOnUnknownUsage := "if any process cannot be found return an error code, not 0"
-	flag.BoolVar(&cliFlags.errorOnUnknown, "error-on-unknown", false, errorOnUnknownUsage)
-	flag.BoolVar(&cliFlags.errorOnUnknown, "u", false, "shorthand for -error-on-unknown")
+	errorOnUnknownFlag(flag.CommandLine, &cliFlags.errorOnUnknown)
+	timeoutFlag(flag.CommandLine, &cliFlags.timeout,
+		"Zero means to poll once, printing every process that already exited")
+	jsonFlag(flag.CommandLine, &cliFlags.json)
 
-	timeoutUsage := "timeout in ms.  Negative implies no timeout.  Zero means to return immediately if no process is ready"
-	flag.Int64Var(&cliFlags.timeoutMs, "timeout", 0, timeoutUsage)
-	flag.Int64Var(&cliFlags.timeoutMs, "t", 0, "shorthand for -timeout")
+	streamUsage := "print every pid as its process terminates, returning once all have"
+	flag.BoolVar(&cliFlags.stream, "stream", false, streamUsage)
+	flag.BoolVar(&cliFlags.stream, "s", false, "shorthand for -stream")
+
+	allReadyUsage := "print every pid whose process has terminated once any has, not just the first"
+	flag.BoolVar(&cliFlags.allReady, "all-ready", false, allReadyUsage)
+
+	timingUsage := "print when each process started and when its exit was observed"
+	flag.BoolVar(&cliFlags.timing, "timing", false, timingUsage)
+
+	usageFlag(flag.CommandLine, &cliFlags.usage)
+
+	threadUsage := "pids are thread ids.  Wait for each thread to exit rather than its process.  Requires Linux 6.9+ unless polling"
+	flag.BoolVar(&cliFlags.thread, "thread", false, threadUsage)
+
+	pidnsUsage := "pids are in this pid namespace: a path such as /proc/<pid>/ns/pid, or the pid of a process in it"
+	flag.StringVar(&cliFlags.pidns, "pidns", "", pidnsUsage)
+
+	labelUsage := "`label` a pid as <label>=<pid> does.  May be repeated: the nth -label labels the nth pid argument"
+	flag.Func("label", labelUsage, func(s string) error {
+		cliFlags.labels = append(cliFlags.labels, s)
+		return nil
+	})
+
+	exitCodeUsage := "print the exit code of each process using the netlink proc connector.  Requires CAP_NET_ADMIN"
+	flag.BoolVar(&cliFlags.exitCode, "exit-code", false, exitCodeUsage)
+
+	stateUsage := "print whether each process is a zombie, gone, invisible, or running as state=.  JSON results always have a state"
+	flag.BoolVar(&cliFlags.state, "state", false, stateUsage)
+
+	untilUsage := "the event to wait for: exit, or exec to wait for a process to exec a new program"
+	until := flag.String("until", string(waitn.EVENT_EXIT), untilUsage)
+
+	backend := backendFlag(flag.CommandLine)
+
+	signals := signalsFlag(flag.CommandLine)
+
+	forwardUsage := "forward an interrupting signal to every watched process before exiting"
+	flag.BoolVar(&cliFlags.forward, "forward", false, forwardUsage)
+
+	parentUsage := "wait for the parent of waitn to exit instead of pids.  Remaining arguments are a command to exec once it does"
+	flag.BoolVar(&cliFlags.parent, "parent", false, parentUsage)
+
+	pgrpUsage := "with -parent, signal this process group once the parent exits"
+	flag.IntVar(&cliFlags.pgrp, "pgrp", 0, pgrpUsage)
+
+	pgrpSignalUsage := "signal to send to -pgrp"
+	pgrpSignal := flag.String("pgrp-signal", "TERM", pgrpSignalUsage)
 
 	flag.Usage = func() {
 		fmt.Fprintln(
 			flag.CommandLine.Output(),
 			`wait for the first of several processes to terminate, as in Bash's wait -n.
-Usage: waitn [-u] [-t <timeout>] <pid>...`)
+Usage: waitn [-u] [-s | -all-ready] [-json] [-until <event>] [-exit-code]
+             [-state] [-timing] [-usage] [-thread] [-pidns <ns>] [-t <timeout>]
+             [-deadline <time>] [-backend <backend>] [-signals <signals>]
+             [-forward] [-label <label>...] [<label>=]<pid>...
+       waitn -parent [-t <timeout>] [-backend <backend>] [-pgrp <pgid> [-pgrp-signal <signal>]]
+             [-- <command>...]
+       waitn jobs [-j <N>] < commands
+       waitn dag <file>
+       waitn supervise -watch [<label>=]<pid>... -- <command>...
+       waitn shell-init {bash|zsh|sh}
+       waitn clock [-clock <name>] [-format ns|s|rfc3339] [-of <pid>]`)
 		flag.PrintDefaults()
 		fmt.Fprintln(flag.CommandLine.Output())
 		fmt.Fprint(
@@ -46,42 +121,177 @@ pid or some pid listed earlier (assuming no pid reuse)
 NOTE WELL: pids may be reused; processes may alias.  If this happens a call to
 waitn may block for the incorrect process with the same pid.
 
-NOTE WELL: this utility uses Linux's pidfd to wait for non-child processes.  It
-is up to you to ensure that the processes you wait for are visible to this call.
-Otherwise the utility may not find the process, and you may incorrectly
-interpret it as having terminated.  It may also result in a panic.
+NOTE WELL: this utility uses Linux's pidfd to wait for non-child processes.  A
+pid that no process has in waitn's pid namespace is taken to have terminated.
+Where waitn can tell that a process may have the pid but cannot see it, as with
+/proc mounted with hidepid or from another pid namespace, the pid is instead
+invisible.  -error-on-unknown=invisible exits with 1 only for invisible pids.
+
+Each result has a state, seen when its process was found to have exited or was
+not found: zombie if its process exited but its parent has not reaped it, gone
+if it has been reaped or no process had the pid, invisible as above, or running
+for -until exec results.  It is printed as state= with -state and always with
+-json.
+
+A pid may be given a label as <label>=<pid>, or with -label, the nth of which
+labels the nth pid argument.  Results for labelled pids print the label and pid
+separated by a space, so scripts need not map pids back to tasks themselves.
+Labels may not be empty or contain whitespace.  A pid may not be given more
+than once with different labels.
+
+When several processes have terminated by the time waitn checks, the first in
+argument order is returned.  With -all-ready every pid whose process has
+terminated is printed in argument order, from a single check made once any
+has.  Pids that cannot be found count as terminated and are printed first.
+-all-ready may not be used with -stream or -until exec.
+
+With -stream every pid is printed as its process terminates, pids that cannot
+be found first and in argument order.  A timeout ends streaming early.
+-error-on-unknown changes the exit code only once all processes terminate.
+
+With -timeout 0 waitn polls each process once without blocking and prints
+every pid whose process has already terminated, pids that cannot be found
+first and then in argument order.  If none has it times out.  This suits
+sweeps that reap whichever background jobs finished.
+
+-timeout takes a duration such as 90s or 2m30s, or ms if a bare number.
+-deadline takes an absolute time so that several sequential calls in a script
+share one budget: RFC3339 such as 2006-01-02T15:04:05Z, @<unix seconds> as
+printed by date, or ns since boot on CLOCK_BOOTTIME as printed by -timing,
+which is unaffected by changes to the wall clock.  Whichever of the two comes first
+applies.  If the deadline has already passed waitn exits without checking any
+process.
+
+-timeout is timed on CLOCK_MONOTONIC by default, which stops while the system
+is suspended, so on a laptop or paused VM a 10m timeout may last hours.  With
+-timeout-clock boottime it is timed by a timerfd on CLOCK_BOOTTIME, so time
+suspended counts.  -deadline is always timed by an absolute timerfd on its own
+clock, CLOCK_REALTIME or CLOCK_BOOTTIME, so it follows changes to the wall
+clock and counts time suspended.
+
+With -until exec waitn waits for a process to exec a new program, as when a
+launcher execs the real binary after setup, rather than to exit.  Execs are read
+from the netlink proc connector if permitted, otherwise each process's
+/proc/<pid>/exe and comm are polled every 10ms.  Execs before waitn starts are
+not seen, nor, when polling, execs of the same program.  A process that exits
+without exec'ing is still a result.  Results append event=exec or event=exit,
+or event with -json.  -until exec may not be used with -thread.
+
+With -exit-code each result also reports the process's exit code, or 128 plus
+the signal number if it was killed by a signal, as exit_code= or exitCode with
+-json.  Pidfds cannot report the exit code of processes that are not children
+of waitn, so exits are read from the netlink proc connector, which requires
+CAP_NET_ADMIN in the initial user and pid namespaces.  Otherwise a warning is
+printed and results have no exit code, as do processes that could not be found
+or exited before waitn started.
+
+With -timing each result also reports the process's start time from
+/proc/<pid>/stat, the time waitn observed its exit, and the elapsed time
+between them.  Text results append start=, start_boot_ns=, exit=,
+exit_boot_ns=, and elapsed= fields; boot times are ns since boot on
+CLOCK_BOOTTIME.  Start times have a resolution of 10ms.  Processes that exited
+before waitn opened them report no timing.
+
+With -usage each result also reports the process's resource usage.  The
+processes are not children of waitn and so have no rusage; instead
+/proc/<pid>/stat and /proc/<pid>/status are sampled every 100ms while they are
+alive and the last sample is reported.  Text results append user=, sys=,
+maxrss_kib=, minflt=, majflt=, nvcsw=, and nivcsw= fields.  The jobs, dag,
+and supervise subcommands take rusage from reaping their commands.
+
+With -thread each pid is a thread id, as from gettid(2) or /proc/<pid>/task,
+and waitn waits for that thread to exit using PIDFD_THREAD.  Without -thread a
+thread id other than its process's pid is an error.  With -forward signals are
+sent to the threads.
+
+With -pidns each pid is a pid in another pid namespace, such as a container's,
+and is translated to our own using the NSpid lines of /proc/<pid>/status.  Only
+processes whose own namespace is the given one are found, not those in nested
+namespaces.  Results print the namespace pid followed by host_pid=, or
+hostPid with -json.  -pidns may not be used with -thread.
+
+With -parent waitn waits for its parent to exit, as a replacement for
+PR_SET_PDEATHSIG in scripts.  The parent is verified not to have exited while
+opening its pidfd.  Once it exits the -pgrp process group is signalled and then
+the command, if any, is exec'd in place of waitn.  Otherwise the parent's pid is
+printed.  With -t 0 the parent is checked once, timing out if it is running.
+
+Processes are waited for using pidfds, which require Linux 5.3+.  Where
+pidfd_open fails with ENOSYS, as on older kernels, or EPERM, as under seccomp
+profiles that block it, each process is instead polled with kill(pid, 0) and
+/proc/<pid>/stat at an interval growing from 1ms to 100ms.  -backend poll
+forces polling and -backend pidfd forbids it.  Polling may signal a process
+that reused a pid with -forward, and without /proc it neither detects reused
+pids nor sees zombies as terminated.  -backend uring is experimental: pidfds are
+polled with a single io_uring instead of epoll, which scales better to many
+pids.  It requires Linux 5.5+ and io_uring not to be disabled.
+
+Each pidfd costs a file descriptor.  waitn raises its soft limit on open files
+to the hard limit and with -backend auto keeps pidfds for as many pids as fit
+within it.  The remaining pids are polled as above at an interval growing to
+1s, each taking a pidfd as another process terminates.  Other backends exit
+with an error when out of file descriptors.  Commands run by the jobs, dag, and
+supervise subcommands start with the soft limit waitn started with.
+
+Interrupting signals are handled as the shell's wait builtin handles trapped
+signals, so waitn may safely run in the foreground.  Pidfds are closed and with
+-forward the signal is first sent to the watched processes using their pidfds.
+Signals ignored when waitn starts, as SIGINT is for background jobs of
+non-interactive shells, remain ignored.
 
 return values:
 0 - a process was found and completed; or a a process was not found and not
 	-error-on-unknown.  The process presumably completed prior to this command
-1 - -error-on-unknown and a process was not found for some pid.  the pid
+1 - -error-on-unknown and a process was not found for some pid, or
+    -error-on-unknown=invisible and some pid was invisible.  the pid
     will be printed to stdout (not err) as when this flag is not provided.
-2 - -timeout and timeout duration exceeded.  Implies that all processes were
+2 - -timeout or -deadline exceeded.  Implies that all processes were
 	found
-127 - other, typically argument parsing error.`)
+3 - a command run by the jobs or dag subcommands failed.
+4 - -deadline had already passed when waitn started.  No process was checked.
+127 - other, typically argument parsing error.
+128+n - interrupted by signal n.`)
 		fmt.Fprintln(flag.CommandLine.Output())
 	}
 
 	flag.Parse()
 
-	if len(flag.Args()) < 1 {
-		fmt.Fprintln(os.Stderr, "no pids provided")
+	cliFlags.signals = parseSignalsOrExit(*signals)
+
+	var err error
+	cliFlags.until, err = waitn.ParseEvent(*until)
+	exitIfError(newPrinter(false, nil), err)
+	cliFlags.backend = parseBackendOrExit(*backend)
+
+	pgrpSignals, err := parseSignals(*pgrpSignal)
+	if err == nil && len(pgrpSignals) != 1 {
+		err = fmt.Errorf("expected a single -pgrp-signal: %v", *pgrpSignal)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		flag.Usage()
 		os.Exit(waitn.INPUT_ERROR)
 	}
+	cliFlags.pgrpSignal = pgrpSignals[0]
 
-	ctx := context.Background()
-	var contextCancel context.CancelFunc = func() {}
-	if cliFlags.timeoutMs > 0 {
-		ctx, contextCancel = context.WithTimeout(
-			ctx, time.Duration(cliFlags.timeoutMs)*time.Millisecond)
+	if len(flag.Args()) < 1 && !cliFlags.parent {
+		fmt.Fprintln(os.Stderr, "no pids provided")
+		flag.Usage()
+		os.Exit(waitn.INPUT_ERROR)
 	}
-	return ctx, contextCancel, cliFlags
+
+	ctx, contextCancel := timeoutContext(cliFlags.timeout)
+	return ctx, contextCancel, cliFlags, notifySignals(cliFlags.signals)
 }
 
-func exitIfResultOrError(pid waitn.ResultPid, e error) {
-	if pid != 0 {
-		fmt.Printf("%v\n", pid)
+// exit as exitIfResultOrError does for an error without a result
+func exitIfError(out *printer, e error) {
+	exitIfResultOrError(out, waitn.Result{}, e)
+}
+
+func exitIfResultOrError(out *printer, result waitn.Result, e error) {
+	if result.Pid != 0 {
+		out.print(result)
 	}
 	if e != nil {
 		err, ok := e.(*waitn.ExitError)
@@ -95,24 +305,195 @@ func exitIfResultOrError(pid waitn.ResultPid, e error) {
 		if err.DisplayUsage {
 			flag.Usage()
 		}
-		os.Exit(err.ExitCode)
+		out.exit(err.ExitCode)
 	}
-	if pid != 0 {
-		os.Exit(waitn.PROCESS_TERMINATED)
+	if result.Pid != 0 {
+		out.exit(waitn.PROCESS_TERMINATED)
 	}
 }
 
+// subcommands, dispatched on the first argument.  Without a subcommand waitn
+// waits for pids.
+var subcommands = map[string]func(args []string){
+	"clock":      clock,
+	"dag":        dag,
+	"jobs":       jobs,
+	"shell-init": shellInit,
+	"supervise":  supervise,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			subcommand(os.Args[2:])
+			return
+		}
+	}
+
 	// parses using flag
-	ctx, ctxCancel, cliFlags := prepare()
+	ctx, ctxCancel, cliFlags, signals := prepare()
 	defer ctxCancel()
 
-	pidFiles, retPid, exitErr := waitn.SetupPidFiles(
-		flag.Args(), cliFlags.errorOnUnknown)
-	exitIfResultOrError(retPid, exitErr)
+	if cliFlags.parent {
+		out := newPrinter(cliFlags.json, nil)
+		out.state = cliFlags.state
+		out.backend = cliFlags.backend
+		parent(ctx, out, cliFlags, signals)
+	}
+
+	targets, exitErr := waitn.ParseTargets(flag.Args(), cliFlags.labels)
+	out := newPrinter(cliFlags.json, targets)
+	out.state = cliFlags.state
+	out.backend = cliFlags.backend
+	exitIfError(out, exitErr)
+	for i := range targets {
+		targets[i].Thread = cliFlags.thread
+	}
+	if cliFlags.thread && cliFlags.pidns != "" {
+		exitIfError(out, conflictingFlagsErr("-pidns", "-thread"))
+	}
+	if cliFlags.thread && cliFlags.until == waitn.EVENT_EXEC {
+		exitIfError(out, conflictingFlagsErr("-until exec", "-thread"))
+	}
+	if cliFlags.allReady && cliFlags.stream {
+		exitIfError(out, conflictingFlagsErr("-all-ready", "-stream"))
+	}
+	if cliFlags.allReady && cliFlags.until == waitn.EVENT_EXEC {
+		exitIfError(out, conflictingFlagsErr("-all-ready", "-until exec"))
+	}
+	if cliFlags.timeout.poll() && cliFlags.until == waitn.EVENT_EXEC {
+		exitIfError(out, conflictingFlagsErr("-until exec", "-timeout 0"))
+	}
+	if cliFlags.pidns != "" {
+		exitIfError(out, waitn.TranslateTargets(
+			targets, waitn.PidNamespacePath(cliFlags.pidns)))
+	}
+
+	if cliFlags.exitCode {
+		out.watchExits(targets)
+	}
+
+	if cliFlags.timeout.poll() {
+		poll(out, targets, cliFlags)
+	}
 
-	retPid, exitErr = waitn.WaitForPidFile(ctx, pidFiles)
-	exitIfResultOrError(retPid, exitErr)
+	if cliFlags.stream {
+		stream(ctx, out, targets, cliFlags, signals)
+	}
+
+	if cliFlags.allReady {
+		allReady(ctx, out, targets, cliFlags, signals)
+	}
+
+	pidFiles, result, exitErr := waitn.SetupPidFiles(
+		cliFlags.backend, targets, cliFlags.errorOnUnknown)
+	exitIfResultOrError(out, result, exitErr)
+	out.observe(pidFiles, cliFlags)
+
+	ctx, signalCancel := signals.watch(ctx, pidFiles, cliFlags.forward)
+	defer signalCancel()
+	if cliFlags.until == waitn.EVENT_EXEC {
+		result, event, exitErr := waitn.WaitForEvent(ctx, pidFiles, execPollInterval)
+		exitIfError(out, exitErr)
+		out.printEvent(result, event)
+		out.exit(waitn.PROCESS_TERMINATED)
+	}
+	result, exitErr = waitn.WaitForPidFile(ctx, pidFiles)
+	exitIfResultOrError(out, result, exitErr)
 
 	panic("no result or error at end of main")
 }
+
+// how often to poll processes for execs with -until exec when the proc
+// connector may not be used
+const execPollInterval = 10 * time.Millisecond
+
+func conflictingFlagsErr(flag1 string, flag2 string) error {
+	return &waitn.ExitError{
+		Message:      fmt.Sprintf("%v may not be used with %v", flag1, flag2),
+		ExitCode:     waitn.INPUT_ERROR,
+		DisplayUsage: true,
+		Cause:        nil}
+}
+
+// print every target that has already completed and exit, timing out if none
+// has.
+func poll(out *printer, targets []waitn.Target, cliFlags cliFlags) {
+	pidFiles, notFound, exitErr := waitn.SetupAllPidFiles(
+		cliFlags.backend, targets)
+	exitIfError(out, exitErr)
+	for _, result := range notFound {
+		out.print(result)
+	}
+	out.observe(pidFiles, cliFlags)
+	ready := waitn.PollPidFiles(pidFiles)
+	for _, result := range ready {
+		out.print(result)
+	}
+
+	exitIfError(out, waitn.UnknownPidsErr(
+		cliFlags.errorOnUnknown, notFound))
+	if len(notFound) == 0 && len(ready) == 0 {
+		exitIfError(out, waitn.TimeoutErr)
+	}
+	out.exit(waitn.PROCESS_TERMINATED)
+}
+
+// print every target that has completed once any has and exit.  Targets that
+// cannot be found have completed, so then there is no waiting.
+func allReady(ctx context.Context, out *printer, targets []waitn.Target,
+	cliFlags cliFlags, signals *signalHandler) {
+	pidFiles, notFound, exitErr := waitn.SetupAllPidFiles(
+		cliFlags.backend, targets)
+	exitIfError(out, exitErr)
+	for _, result := range notFound {
+		out.print(result)
+	}
+
+	out.observe(pidFiles, cliFlags)
+	var ready []waitn.Result
+	if len(notFound) > 0 {
+		ready = waitn.PollPidFiles(pidFiles)
+	} else {
+		ctx, signalCancel := signals.watch(ctx, pidFiles, cliFlags.forward)
+		defer signalCancel()
+		ready, exitErr = waitn.WaitForReady(ctx, pidFiles)
+		exitIfError(out, exitErr)
+	}
+	for _, result := range ready {
+		out.print(result)
+	}
+
+	exitIfError(out, waitn.UnknownPidsErr(
+		cliFlags.errorOnUnknown, notFound))
+	out.exit(waitn.PROCESS_TERMINATED)
+}
+
+// print every target as it completes and exit.
+func stream(ctx context.Context, out *printer, targets []waitn.Target,
+	cliFlags cliFlags, signals *signalHandler) {
+	pidFiles, notFound, exitErr := waitn.SetupAllPidFiles(
+		cliFlags.backend, targets)
+	exitIfError(out, exitErr)
+	for _, result := range notFound {
+		out.print(result)
+	}
+
+	if len(pidFiles) > 0 {
+		out.observe(pidFiles, cliFlags)
+		ctx, signalCancel := signals.watch(ctx, pidFiles, cliFlags.forward)
+		defer signalCancel()
+		var exitErr error
+		if cliFlags.until == waitn.EVENT_EXEC {
+			exitErr = waitn.StreamEvents(ctx, pidFiles, execPollInterval,
+				out.printEvent)
+		} else {
+			exitErr = waitn.StreamPidFiles(ctx, pidFiles, out.print)
+		}
+		exitIfError(out, exitErr)
+	}
+
+	exitIfError(out, waitn.UnknownPidsErr(
+		cliFlags.errorOnUnknown, notFound))
+	out.exit(waitn.PROCESS_TERMINATED)
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/waitn"
+)
+
+// a single result as printed with -json
+type jsonResult struct {
+	Pid   int    `json:"pid"`
+	Label string `json:"label,omitempty"`
+	// with -pidns Pid is the namespace pid
+	HostPid int `json:"hostPid,omitempty"`
+	// with -until exec
+	Event waitn.Event `json:"event,omitempty"`
+	// whether the process is running, a zombie, gone, or invisible
+	State waitn.ProcessState `json:"state"`
+	// with -exit-code, if the exit was reported
+	ExitCode *int `json:"exitCode,omitempty"`
+	*jsonTiming
+	Usage *jsonUsage `json:"usage,omitempty"`
+}
+
+// resource usage as printed with -json -usage
+type jsonUsage struct {
+	UserMs              int64 `json:"userMs"`
+	SystemMs            int64 `json:"systemMs"`
+	MaxRSSKiB           int64 `json:"maxRssKiB"`
+	MinorFaults         int64 `json:"minorFaults"`
+	MajorFaults         int64 `json:"majorFaults"`
+	VoluntarySwitches   int64 `json:"voluntarySwitches"`
+	InvoluntarySwitches int64 `json:"involuntarySwitches"`
+}
+
+func newJSONUsage(usage proc.Usage) *jsonUsage {
+	return &jsonUsage{
+		UserMs:              usage.UserTime.Milliseconds(),
+		SystemMs:            usage.SystemTime.Milliseconds(),
+		MaxRSSKiB:           usage.MaxRSSKiB,
+		MinorFaults:         usage.MinorFaults,
+		MajorFaults:         usage.MajorFaults,
+		VoluntarySwitches:   usage.VoluntarySwitches,
+		InvoluntarySwitches: usage.InvoluntarySwitches}
+}
+
+// usage as printed in text, as space separated key=value fields
+func usageFields(usage proc.Usage) string {
+	return fmt.Sprintf("user=%v sys=%v maxrss_kib=%v minflt=%v majflt=%v nvcsw=%v nivcsw=%v",
+		usage.UserTime, usage.SystemTime, usage.MaxRSSKiB, usage.MinorFaults,
+		usage.MajorFaults, usage.VoluntarySwitches, usage.InvoluntarySwitches)
+}
+
+// process timing as printed with -json -timing.  Boot times are ns on
+// CLOCK_BOOTTIME.
+type jsonTiming struct {
+	Start       time.Time `json:"start"`
+	StartBootNs int64     `json:"startBootNs"`
+	Exit        time.Time `json:"exit"`
+	ExitBootNs  int64     `json:"exitBootNs"`
+	ElapsedMs   int64     `json:"elapsedMs"`
+}
+
+// a job result as printed with -json
+type jsonJob struct {
+	Index      int        `json:"index"`
+	Command    string     `json:"command"`
+	Pid        int        `json:"pid"`
+	ExitCode   int        `json:"exitCode"`
+	Restarts   int        `json:"restarts,omitempty"`
+	Restarting bool       `json:"restarting,omitempty"`
+	Usage      *jsonUsage `json:"usage,omitempty"`
+}
+
+// a task result as printed with -json
+type jsonTask struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Pid        int        `json:"pid,omitempty"`
+	ExitCode   int        `json:"exitCode"`
+	DurationMs int64      `json:"durationMs"`
+	Usage      *jsonUsage `json:"usage,omitempty"`
+}
+
+// prints results to stdout, one per line.  Text results are the pid, or the
+// label and pid separated by a space if the target was labelled.  JSON results
+// are one object per line.
+type printer struct {
+	out     io.Writer
+	json    bool
+	targets []waitn.Target
+	// with -timing, start times by pid.  A process's exit is observed when its
+	// result is printed.
+	timings map[int]*waitn.Timing
+	// with -usage.  Pid results take their usage from sampler.
+	usage   bool
+	sampler *waitn.UsageSampler
+	// with -exit-code, if the proc connector could be used
+	exits *waitn.ExitWatcher
+	// with -state, text results print their state.  JSON results always do.
+	state bool
+	// the backend waiting for results, closed with the printer if it must be,
+	// as the uring backend must
+	backend waitn.Backend
+}
+
+func newPrinter(json bool, targets []waitn.Target) *printer {
+	return &printer{out: os.Stdout, json: json, targets: targets}
+}
+
+// how often to sample the usage of processes with -usage
+const usageSampleInterval = 100 * time.Millisecond
+
+// start observing the processes of pidFiles for -timing and -usage
+func (p *printer) observe(pidFiles []waitn.PidFile, cliFlags cliFlags) {
+	if cliFlags.timing {
+		p.timings = waitn.StartTimings(pidFiles)
+	}
+	if cliFlags.usage {
+		p.usage = true
+		p.sampler = waitn.SampleUsage(pidFiles, usageSampleInterval)
+	}
+}
+
+// with -exit-code, start collecting the exit codes of targets' processes.
+// Without the proc connector results have no exit code and waitn relies on
+// pidfds alone.
+func (p *printer) watchExits(targets []waitn.Target) {
+	pids := make([]int, 0, len(targets))
+	for _, target := range targets {
+		if target.Pid != 0 {
+			pids = append(pids, target.Pid)
+		}
+	}
+	exits, err := waitn.WatchExits(pids)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exit codes unavailable: %v\n", err)
+		return
+	}
+	p.exits = exits
+}
+
+// stop collecting exit codes and sampling usage once every result is printed,
+// closing the proc connector, and close the backend
+func (p *printer) close() {
+	if p.exits != nil {
+		p.exits.Stop()
+		p.exits = nil
+	}
+	if p.sampler != nil {
+		p.sampler.Stop()
+		p.sampler = nil
+	}
+	if closer, ok := p.backend.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "close backend: %v\n", err)
+		}
+		p.backend = nil
+	}
+}
+
+// close the printer and exit with code
+func (p *printer) exit(code int) {
+	p.close()
+	os.Exit(code)
+}
+
+// print a result's pid.  With state, exit codes, timing, or usage text results
+// are followed by space separated key=value fields.  Pids translated from
+// another pid namespace print their namespace pid followed by their host pid.
+func (p *printer) print(result waitn.Result) {
+	p.printEvent(result, "")
+}
+
+// print a result as print does, along with the event it is the result of if
+// not empty.  Exec events have no exit code or timing.
+func (p *printer) printEvent(result waitn.Result, event waitn.Event) {
+	pid := result.Pid
+	target, _ := waitn.TargetOf(p.targets, pid)
+	label := target.Label
+	shownPid, hostPid := int(pid), 0
+	if target.NsPid != 0 {
+		shownPid, hostPid = target.NsPid, target.Pid
+	}
+	timing := p.timings[int(pid)]
+	if event == waitn.EVENT_EXEC {
+		timing = nil
+	} else if timing != nil {
+		timing.Exited()
+	}
+	var exitCode *int
+	if p.exits != nil && event != waitn.EVENT_EXEC {
+		exitCodeOf := p.exits.ExitCode
+		if result.NotFound {
+			// not found, so its exit was most likely never reported
+			exitCodeOf = p.exits.ReportedExitCode
+		}
+		if code, ok := exitCodeOf(int(pid)); ok {
+			exitCode = &code
+		}
+	}
+	var usage *proc.Usage
+	if p.usage && p.sampler != nil {
+		if u, ok := p.sampler.Last(int(pid)); ok {
+			usage = &u
+		}
+	}
+	if p.json {
+		jsonResult := jsonResult{Pid: shownPid, Label: label, HostPid: hostPid,
+			Event: event, State: result.State, ExitCode: exitCode}
+		if timing != nil {
+			jsonResult.jsonTiming = &jsonTiming{
+				Start:       timing.Start,
+				StartBootNs: timing.StartBoot.Nanoseconds(),
+				Exit:        timing.Exit,
+				ExitBootNs:  timing.ExitBoot.Nanoseconds(),
+				ElapsedMs:   timing.Elapsed().Milliseconds()}
+		}
+		if usage != nil {
+			jsonResult.Usage = newJSONUsage(*usage)
+		}
+		p.printJSON(jsonResult)
+		return
+	}
+	if label != "" {
+		fmt.Fprintf(p.out, "%v ", label)
+	}
+	fmt.Fprintf(p.out, "%v", shownPid)
+	if hostPid != 0 {
+		fmt.Fprintf(p.out, " host_pid=%v", hostPid)
+	}
+	if event != "" {
+		fmt.Fprintf(p.out, " event=%v", event)
+	}
+	if p.state {
+		fmt.Fprintf(p.out, " state=%v", result.State)
+	}
+	if exitCode != nil {
+		fmt.Fprintf(p.out, " exit_code=%v", *exitCode)
+	}
+	if timing != nil {
+		fmt.Fprintf(p.out, " start=%v start_boot_ns=%v exit=%v exit_boot_ns=%v elapsed=%v",
+			timing.Start.Format(time.RFC3339Nano),
+			timing.StartBoot.Nanoseconds(),
+			timing.Exit.Format(time.RFC3339Nano),
+			timing.ExitBoot.Nanoseconds(),
+			timing.Elapsed())
+	}
+	if usage != nil {
+		fmt.Fprintf(p.out, " %v", usageFields(*usage))
+	}
+	fmt.Fprintln(p.out)
+}
+
+// print a job result.  Text is the job's index, exit code, and command
+// separated by spaces, with "restart" after the index if the job will be
+// restarted.  With usage the usage fields precede the command.
+func (p *printer) printJob(result waitn.JobResult) {
+	if p.json {
+		job := jsonJob{
+			Index:      result.Index,
+			Command:    result.Command,
+			Pid:        result.Pid,
+			ExitCode:   result.ExitCode,
+			Restarts:   result.Restarts,
+			Restarting: result.Restarting}
+		if p.usage {
+			job.Usage = newJSONUsage(result.Usage)
+		}
+		p.printJSON(job)
+		return
+	}
+	if result.Restarting {
+		fmt.Fprint(p.out, result.Index, " restart ")
+	} else {
+		fmt.Fprint(p.out, result.Index, " ")
+	}
+	fmt.Fprint(p.out, result.ExitCode, " ")
+	if p.usage {
+		fmt.Fprint(p.out, usageFields(result.Usage), " ")
+	}
+	fmt.Fprintln(p.out, result.Command)
+}
+
+// print the final result of the command run by supervise as a result labelled
+// "command", with its exit code and, with usage, the usage fields.
+func (p *printer) printSupervised(result waitn.SuperviseResult) {
+	if p.json {
+		command := jsonResult{Pid: result.Pid, Label: "command",
+			State: waitn.PROCESS_GONE, ExitCode: &result.ExitCode}
+		if p.usage {
+			command.Usage = newJSONUsage(result.Usage)
+		}
+		p.printJSON(command)
+		return
+	}
+	fmt.Fprintf(p.out, "command %v exit_code=%v", result.Pid, result.ExitCode)
+	if p.usage {
+		fmt.Fprintf(p.out, " %v", usageFields(result.Usage))
+	}
+	fmt.Fprintln(p.out)
+}
+
+func (p *printer) printJSON(v any) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(p.out, string(bytes))
+}
+
+// print a summary of task results.  Text is a table.
+func (p *printer) printTasks(results []waitn.TaskResult) {
+	if p.json {
+		for _, result := range results {
+			task := jsonTask{
+				Name:       result.Name,
+				Status:     string(result.Status),
+				Pid:        result.Pid,
+				ExitCode:   result.ExitCode,
+				DurationMs: result.End.Sub(result.Start).Milliseconds()}
+			if p.usage && result.Status != waitn.TASK_SKIPPED {
+				task.Usage = newJSONUsage(result.Usage)
+			}
+			p.printJSON(task)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "TASK\tSTATUS\tEXIT\tDURATION")
+	if p.usage {
+		fmt.Fprint(w, "\tUSER\tSYS\tMAXRSS_KIB")
+	}
+	fmt.Fprintln(w)
+	for _, result := range results {
+		if result.Status == waitn.TASK_SKIPPED {
+			fmt.Fprintf(w, "%v\t%v\t-\t-", result.Name, result.Status)
+			if p.usage {
+				fmt.Fprint(w, "\t-\t-\t-")
+			}
+			fmt.Fprintln(w)
+			continue
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v", result.Name, result.Status,
+			result.ExitCode, result.End.Sub(result.Start).Round(time.Millisecond))
+		if p.usage {
+			fmt.Fprintf(w, "\t%v\t%v\t%v", result.Usage.UserTime,
+				result.Usage.SystemTime, result.Usage.MaxRSSKiB)
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintTiming(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now().Add(-time.Second)
+	newTimings := func() map[int]*waitn.Timing {
+		return map[int]*waitn.Timing{
+			10: {StartBoot: time.Hour, Start: start}}
+	}
+
+	var buf bytes.Buffer
+	targets := []waitn.Target{{Pid: 10, Label: "a"}}
+	p := &printer{out: &buf, targets: targets, timings: newTimings()}
+	p.print(waitn.Result{Pid: 10})
+	p.print(waitn.Result{Pid: 11})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(lines, 2)
+	fields := strings.Fields(lines[0])
+	require.Equal([]string{"a", "10"}, fields[:2])
+	require.Equal("start="+start.Format(time.RFC3339Nano), fields[2])
+	require.Equal("start_boot_ns=3600000000000", fields[3])
+	require.True(strings.HasPrefix(fields[6], "elapsed="))
+	require.Equal("11", lines[1])
+
+	buf.Reset()
+	p = &printer{out: &buf, json: true, timings: newTimings()}
+	p.print(waitn.Result{Pid: 10})
+	var result map[string]any
+	require.NoError(json.Unmarshal(buf.Bytes(), &result))
+	require.Equal(float64(10), result["pid"])
+	require.Equal(float64(time.Hour.Nanoseconds()), result["startBootNs"])
+	require.Contains(result, "exit")
+	require.Contains(result, "exitBootNs")
+	require.Contains(result, "elapsedMs")
+}
+
+func TestPrintNsPid(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	targets := []waitn.Target{{Pid: 4742, NsPid: 2, Label: "a"}, {NsPid: 3}}
+	p := &printer{out: &buf, targets: targets}
+	p.print(waitn.Result{Pid: 4742, State: waitn.PROCESS_ZOMBIE})
+	p.print(waitn.Result{Pid: 3, State: waitn.PROCESS_GONE, NotFound: true})
+	require.Equal("a 2 host_pid=4742\n3\n", buf.String())
+
+	buf.Reset()
+	p.json = true
+	p.print(waitn.Result{Pid: 4742, State: waitn.PROCESS_ZOMBIE})
+	require.Equal(`{"pid":2,"label":"a","hostPid":4742,"state":"zombie"}`+"\n",
+		buf.String())
+}
+
+func TestPrintState(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	p := &printer{out: &buf, targets: []waitn.Target{{Pid: 5, Label: "a"}},
+		state: true}
+	p.print(waitn.Result{Pid: 5, State: waitn.PROCESS_ZOMBIE})
+	p.print(waitn.Result{Pid: 6, State: waitn.PROCESS_INVISIBLE, NotFound: true})
+	p.printEvent(waitn.Result{Pid: 7, State: waitn.PROCESS_RUNNING},
+		waitn.EVENT_EXEC)
+	require.Equal("a 5 state=zombie\n6 state=invisible\n"+
+		"7 event=exec state=running\n", buf.String())
+}
+
+func TestLabelFlag(t *testing.T) {
+	require := require.New(t)
+
+	// pids above pid_max are never found
+	out, err := exec.Command(waitnBin, "-label", "a", "99999999").Output()
+	require.NoError(err)
+	require.Equal("a 99999999\n", string(out))
+
+	err = exec.Command(waitnBin, "a=99999999", "b=99999999").Run()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+}
+
+func TestPrintJobUsage(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	p := &printer{out: &buf, usage: true}
+	p.printJob(waitn.JobResult{
+		Index:    1,
+		Command:  "FOO=1 make",
+		ExitCode: 2,
+		Usage: proc.Usage{
+			UserTime:    1500 * time.Millisecond,
+			SystemTime:  time.Second,
+			MaxRSSKiB:   1024,
+			MinorFaults: 3}})
+	require.Equal(
+		"1 2 user=1.5s sys=1s maxrss_kib=1024 minflt=3 majflt=0 nvcsw=0 nivcsw=0 FOO=1 make\n",
+		buf.String())
+
+	buf.Reset()
+	p.json = true
+	p.printJob(waitn.JobResult{Index: 1, Usage: proc.Usage{MaxRSSKiB: 1024}})
+	var result map[string]any
+	require.NoError(json.Unmarshal(buf.Bytes(), &result))
+	require.Equal(float64(1024), result["usage"].(map[string]any)["maxRssKiB"])
+}
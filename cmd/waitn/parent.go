@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"golang.org/x/sys/unix"
+)
+
+// wait for the parent of this process to exit.  Then signal the process group,
+// if any, and exec the command, if any.  With -timeout 0 the parent is checked
+// once, timing out if it is still running.
+func parent(ctx context.Context, out *printer, cliFlags cliFlags,
+	signals *signalHandler) {
+	pidFile, result := waitn.SetupParentPidFile(cliFlags.backend)
+	if pidFile != nil && cliFlags.timeout.poll() {
+		ready := waitn.PollPidFiles([]waitn.PidFile{pidFile})
+		if len(ready) == 0 {
+			exitIfError(out, waitn.TimeoutErr)
+		}
+		result = ready[0]
+	} else if pidFile != nil {
+		pidFiles := []waitn.PidFile{pidFile}
+		ctx, signalCancel := signals.watch(ctx, pidFiles, cliFlags.forward)
+		defer signalCancel()
+		var exitErr error
+		result, exitErr = waitn.WaitForPidFile(ctx, pidFiles)
+		exitIfError(out, exitErr)
+	}
+
+	if cliFlags.pgrp != 0 {
+		err := unix.Kill(-cliFlags.pgrp, cliFlags.pgrpSignal)
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			fmt.Fprintf(os.Stderr, "signal process group %v: %v\n", cliFlags.pgrp, err)
+		}
+	}
+
+	if len(flag.Args()) == 0 {
+		exitIfResultOrError(out, result, nil)
+	}
+	out.close()
+	execCommand(flag.Args())
+}
+
+// replace this process with the command.  Exits with INPUT_ERROR if the
+// command cannot be found, as shells do.
+func execCommand(args []string) {
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	err = syscall.Exec(path, args, os.Environ())
+	panic(fmt.Sprintf("exec %v: %v", path, err))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParentExec(t *testing.T) {
+	require := require.New(t)
+
+	// waitn outlives its parent shell and holds the output open until it execs
+	out, err := exec.Command("sh", "-c", `"$0" -parent -- echo parent exited &
+sleep 0.2
+echo shell exiting`, waitnBin).CombinedOutput()
+	require.NoError(err, string(out))
+	require.Equal("shell exiting\nparent exited\n", string(out))
+}
+
+func TestParentPoll(t *testing.T) {
+	require := require.New(t)
+
+	// the test process is still running, so waitn times out without waiting
+	// for it or running the command
+	start := time.Now()
+	out, err := exec.Command(waitnBin, "-parent", "-t", "0", "--",
+		"echo", "parent exited").CombinedOutput()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.TIMEOUT_ERROR, exitErr.ExitCode())
+	require.Equal("timed out\n", string(out))
+	require.Less(time.Since(start), 5*time.Second)
+}
+
+func TestParentSignalProcessGroup(t *testing.T) {
+	require := require.New(t)
+
+	sleep := exec.Command("sleep", "10")
+	sleep.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(sleep.Start())
+	pgid := strconv.Itoa(sleep.Process.Pid)
+
+	shell := exec.Command("sh", "-c", `"$0" -parent -pgrp "$1" -pgrp-signal KILL &
+sleep 0.2`, waitnBin, pgid)
+	out, err := shell.CombinedOutput()
+	require.NoError(err, string(out))
+	require.Equal(strconv.Itoa(shell.Process.Pid), strings.TrimSpace(string(out)))
+
+	sleep.Wait()
+	status := sleep.ProcessState.Sys().(syscall.WaitStatus)
+	require.True(status.Signaled())
+	require.Equal(syscall.SIGKILL, status.Signal())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPidns(t *testing.T) {
+	require := require.New(t)
+
+	if os.Geteuid() != 0 {
+		t.Skip("unshare --pid requires root")
+	}
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip(err)
+	}
+
+	// sh is pid 1 in the new namespace and the first sleep pid 2
+	cmd := exec.Command("unshare", "--pid", "--fork", "sh", "-c",
+		"sleep 0.3; sleep 0.3")
+	require.NoError(cmd.Start())
+	defer cmd.Process.Kill()
+	children := "/proc/" + strconv.Itoa(cmd.Process.Pid) + "/task/" +
+		strconv.Itoa(cmd.Process.Pid) + "/children"
+	var sh string
+	require.Eventually(func() bool {
+		b, err := os.ReadFile(children)
+		sh = strings.TrimSpace(string(b))
+		return err == nil && sh != ""
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var out bytes.Buffer
+	waitCmd := exec.Command(waitnBin, "-pidns", sh, "-json", "s=2", "1")
+	waitCmd.Stdout = &out
+	require.NoError(waitCmd.Run())
+	var result map[string]any
+	require.NoError(json.Unmarshal(out.Bytes(), &result))
+	require.Equal("s", result["label"])
+	require.Equal(float64(2), result["pid"])
+	require.NotEqual(float64(2), result["hostPid"])
+	require.NoError(cmd.Wait())
+}
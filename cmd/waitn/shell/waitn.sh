@@ -0,0 +1,68 @@
+# waitn integration for @NAME@, generated by "waitn shell-init @SHELL@".
+# Load with: eval "$(waitn shell-init @SHELL@)"
+_waitn_bin=@WAITN@
+
+# intended to match bash's "wait -n -p VARNAME pids..."
+# waitn_wait [-p VARNAME] [waitn flags] pid...
+#
+# returns the exit code of the first listed process to terminate, including
+# processes that terminated before this call.  Only children of this shell have
+# an exit code; other processes return 127 as wait does.  VARNAME, if provided,
+# is assigned the pid.
+#
+# as with wait, a trapped signal interrupts this call.  It returns 128 plus the
+# signal number and VARNAME is assigned the empty string.
+#
+@SCOPE@
+waitn_wait() {
+@PRELUDE@
+    if [ "$1" = "-p" ]; then
+        _waitn_var=$2
+        shift 2
+        case $_waitn_var in
+            ''|_waitn_*|[0-9]*|*[!A-Za-z0-9_]*)
+                echo "waitn_wait: invalid variable name: $_waitn_var" >&2
+                return 127
+                ;;
+        esac
+    fi
+
+    _waitn_out=$(mktemp) || return 127
+    "$_waitn_bin" "$@" > "$_waitn_out" &
+    _waitn_waitn_pid=$!
+    wait "$_waitn_waitn_pid"
+    _waitn_ret=$?
+
+    if [ "$_waitn_ret" -gt 128 ]; then
+        # woke up due to a trapped signal.  Stop waitn and join it so that it
+        # doesn't write to the output file after it is removed.  If waitn is
+        # already gone it was killed and we report that the same way.
+        if kill -0 "$_waitn_waitn_pid" 2>/dev/null; then
+            kill "$_waitn_waitn_pid" 2>/dev/null
+            # some shells report the killed job on stderr
+            while kill -0 "$_waitn_waitn_pid" 2>/dev/null; do
+                wait "$_waitn_waitn_pid" 2>/dev/null
+            done
+        fi
+        rm -f "$_waitn_out"
+        [ -n "$_waitn_var" ] && eval "$_waitn_var="
+        return "$_waitn_ret"
+    fi
+
+    # 0 a process terminated, 1 a process was not found with -u.  Otherwise
+    # waitn timed out or failed and there is no pid.
+    if [ "$_waitn_ret" -gt 1 ]; then
+        rm -f "$_waitn_out"
+        [ -n "$_waitn_var" ] && eval "$_waitn_var="
+        return "$_waitn_ret"
+    fi
+
+    # labelled pids print "<label> <pid>"; the pid is always last
+    read -r _waitn_line < "$_waitn_out"
+    rm -f "$_waitn_out"
+    _waitn_pid=${_waitn_line##* }
+    wait "$_waitn_pid" 2>/dev/null
+    _waitn_ret=$?
+    [ -n "$_waitn_var" ] && eval "$_waitn_var=\$_waitn_pid"
+    return "$_waitn_ret"
+}
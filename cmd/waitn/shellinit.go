@@ -0,0 +1,106 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+)
+
+// the functions as POSIX sh, with @NAME@, @SHELL@, @SCOPE@, and @PRELUDE@
+// filled in from a shellShim and @WAITN@ with the path to this binary
+//
+//go:embed shell/waitn.sh
+var shellScript string
+
+// what differs between shells in the functions
+type shellShim struct {
+	// the shell as named in the header comment
+	name string
+	// a comment on how VARNAME and our variables are scoped
+	scope string
+	// the start of waitn_wait, declaring its variables
+	prelude string
+}
+
+// shim for each supported shell, by shell-init argument
+var shellShims = map[string]shellShim{
+	"bash": {
+		name: "bash",
+		scope: `# VARNAME is assigned in the caller's scope, so it may be a local of the
+# caller.  Our locals are prefixed with _waitn_ and the caller must not pass
+# such a variable with -p as it would be assigned instead.`,
+		prelude: `    local _waitn_var= _waitn_out _waitn_waitn_pid _waitn_ret _waitn_line _waitn_pid`,
+	},
+	"zsh": {
+		name: "zsh",
+		scope: `# VARNAME is assigned in the caller's scope, so it may be a local of the
+# caller.  Our locals are prefixed with _waitn_ and the caller must not pass
+# such a variable with -p as it would be assigned instead.`,
+		prelude: `    # predictable options regardless of the caller's, restored on return.
+    # without traps_async zsh runs traps only after the awaited child exits,
+    # which would defeat interrupting wait.
+    emulate -L zsh
+    setopt traps_async
+    local _waitn_var= _waitn_out _waitn_waitn_pid _waitn_ret _waitn_line _waitn_pid`,
+	},
+	"sh": {
+		name: "POSIX sh",
+		scope: `# sh has no local variables.  All variables here are prefixed with _waitn_ and
+# the caller must not pass such a variable with -p.`,
+		prelude: `    _waitn_var=`,
+	},
+}
+
+// the functions for shell, calling the waitn binary at bin
+func shellFunctions(shell string, bin string) string {
+	shim := shellShims[shell]
+	return strings.NewReplacer(
+		"@NAME@", shim.name,
+		"@SHELL@", shell,
+		"@SCOPE@", shim.scope,
+		"@PRELUDE@", shim.prelude,
+		"@WAITN@", shellQuote(bin),
+	).Replace(shellScript)
+}
+
+func shellInitUsage() {
+	fmt.Fprint(os.Stderr,
+		`print shell functions wrapping waitn to stdout, to be loaded with eval.
+Usage: waitn shell-init {bash|zsh|sh}
+
+Defines waitn_wait [-p VARNAME] [waitn flags] pid..., intended to match bash's
+wait -n -p VARNAME pid...  It returns the exit code of the first process to
+terminate, including processes that terminated before the call, and returns
+128 plus the signal number if interrupted by a trapped signal.  The functions
+call this waitn binary by its absolute path.
+
+  eval "$(waitn shell-init sh)"
+`)
+}
+
+// waitn shell-init {bash|zsh|sh}
+func shellInit(args []string) {
+	if len(args) != 1 {
+		shellInitUsage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	if _, ok := shellShims[args[0]]; !ok {
+		fmt.Fprintf(os.Stderr, "unsupported shell: %v\n", args[0])
+		shellInitUsage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(shellFunctions(args[0], bin))
+}
+
+// quote s as a single shell word.  Valid for sh, bash, and zsh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// waitn binary built for integration tests
+var waitnBin string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "waitn-test")
+	if err != nil {
+		panic(err)
+	}
+	waitnBin = filepath.Join(dir, "waitn")
+	out, err := exec.Command("go", "build", "-o", waitnBin, ".").CombinedOutput()
+	if err != nil {
+		panic(fmt.Sprintf("building waitn: %v: %s", err, out))
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// each shell to test and the shell-init name for it.  Shells that aren't
+// installed are skipped, except in CI, which installs them all.
+var testShells = []struct {
+	bin      string
+	initName string
+}{
+	{bin: "bash", initName: "bash"},
+	{bin: "zsh", initName: "zsh"},
+	{bin: "dash", initName: "sh"},
+}
+
+// run script with the shell after loading the shell-init functions.
+// returns combined output.
+func runShell(t *testing.T, shell string, initName string, script string) string {
+	t.Helper()
+	script = fmt.Sprintf("eval \"$('%v' shell-init %v)\"\n%v", waitnBin, initName, script)
+	out, err := exec.Command(shell, "-c", script).CombinedOutput()
+	require.NoError(t, err, string(out))
+	return string(out)
+}
+
+func forEachShell(t *testing.T, f func(t *testing.T, shell string, initName string)) {
+	for _, testShell := range testShells {
+		testShell := testShell
+		t.Run(testShell.bin, func(t *testing.T) {
+			shell, err := exec.LookPath(testShell.bin)
+			if err != nil && os.Getenv("CI") != "" {
+				t.Fatalf("%v not installed", testShell.bin)
+			} else if err != nil {
+				t.Skipf("%v not installed", testShell.bin)
+			}
+			f(t, shell, testShell.initName)
+		})
+	}
+}
+
+func TestShellInitExample(t *testing.T) {
+	forEachShell(t, func(t *testing.T, shell string, initName string) {
+		cmd := exec.Command(shell, "../../examples/portable.sh")
+		cmd.Env = append(os.Environ(), "WAITN="+waitnBin)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		require.Equal(t, `FINISHED exit code 1
+FINISHED exit code 2
+FINISHED exit code 3
+TRAPPED
+INTERRUPTED exit code 138 pid ''
+`, string(out))
+	})
+}
+
+// the bash examples, using wait.bash, print "FINISHED <task> exit code <code>"
+// as each task finishes.  Times are removed.
+func TestBashExamples(t *testing.T) {
+	for script, want := range map[string]string{
+		"simple.sh": `FINISHED 1 exit code 1
+FINISHED 2 exit code 2
+FINISHED 3 exit code 3
+`,
+		"finish_order.sh": `FINISHED 1 exit code 1
+FINISHED 2 exit code 143
+FINISHED 3 exit code 3
+FINISHED 4 exit code 143
+`,
+		"forward_sigterm.sh": `FINISHED 1 exit code 1
+killing bash!
+killing jobs from handler
+FINISHED 2 exit code 143
+`,
+		"test_common.sh": "",
+	} {
+		script, want := script, want
+		t.Run(script, func(t *testing.T) {
+			t.Parallel()
+			out, err := runExample(t, script)
+			if script == "forward_sigterm.sh" {
+				// terminates itself once its jobs have
+				var exitErr *exec.ExitError
+				require.ErrorAs(t, err, &exitErr, out)
+				require.Equal(t, -1, exitErr.ExitCode(), out)
+			} else {
+				require.NoError(t, err, out)
+			}
+			if script == "test_common.sh" {
+				require.Regexp(t, `finished 1 pid: \d+ exit: 1 @`, out)
+				return
+			}
+			require.Equal(t, want, finishedLines(out))
+		})
+	}
+
+	// tasks with equal sleeps may finish in either order
+	t.Run("limit_concurrency.sh", func(t *testing.T) {
+		t.Parallel()
+		out, err := runExample(t, "limit_concurrency.sh")
+		require.NoError(t, err, out)
+		finished := strings.Split(strings.TrimSpace(finishedLines(out)), "\n")
+		sort.Strings(finished)
+		want := make([]string, 10)
+		for i := range want {
+			want[i] = fmt.Sprintf("FINISHED %v exit code %v", i, i)
+		}
+		require.Equal(t, want, finished)
+	})
+}
+
+// run an example with bash, calling the waitn under test, and return its
+// combined output.  Output goes to a file rather than a pipe so that sleeps
+// left behind by killed tasks don't hold it open.
+func runExample(t *testing.T, script string) (string, error) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	require.NoError(t, err)
+	defer out.Close()
+	cmd := exec.Command("bash", filepath.Join("../../examples", script))
+	cmd.Env = append(os.Environ(), "WAITN="+waitnBin)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	contents, readErr := os.ReadFile(out.Name())
+	require.NoError(t, readErr)
+	return string(contents), err
+}
+
+// lines of output other than STARTING lines, without their times
+func finishedLines(out string) string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" || strings.HasPrefix(line, "STARTING") {
+			continue
+		}
+		lines = append(lines, regexp.MustCompile(` @\d+$`).ReplaceAllString(line, ""))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestShellInitFinishedBeforeCall(t *testing.T) {
+	forEachShell(t, func(t *testing.T, shell string, initName string) {
+		out := runShell(t, shell, initName, `
+{ exit 5; } &
+pid=$!
+sleep 0.2
+waitn_wait -p finished $pid
+ret=$?
+[ "$finished" = "$pid" ] && echo "$ret"`)
+		require.Equal(t, "5\n", out)
+	})
+}
+
+func TestShellInitLabels(t *testing.T) {
+	forEachShell(t, func(t *testing.T, shell string, initName string) {
+		out := runShell(t, shell, initName, `
+{ sleep 0.1; exit 3; } &
+pid=$!
+waitn_wait -p finished task=$pid
+ret=$?
+[ "$finished" = "$pid" ] && echo "$ret"`)
+		require.Equal(t, "3\n", out)
+	})
+}
+
+func TestShellInitBadVarName(t *testing.T) {
+	forEachShell(t, func(t *testing.T, shell string, initName string) {
+		out := runShell(t, shell, initName, `
+waitn_wait -p _waitn_pid $$
+echo "$?"`)
+		require.Contains(t, out, "invalid variable name")
+		require.Contains(t, out, "127\n")
+	})
+}
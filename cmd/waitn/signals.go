@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"golang.org/x/sys/unix"
+)
+
+// parse a comma separated list of signal names (with or without SIG) or
+// numbers.  The empty string is no signals.
+func parseSignals(s string) ([]syscall.Signal, error) {
+	var sigs []syscall.Signal
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if num, err := strconv.Atoi(name); err == nil {
+			if unix.SignalName(syscall.Signal(num)) == "" {
+				return nil, fmt.Errorf("unknown signal: %v", name)
+			}
+			sigs = append(sigs, syscall.Signal(num))
+			continue
+		}
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		sig := unix.SignalNum(name)
+		if sig == 0 {
+			return nil, fmt.Errorf("unknown signal: %v", name)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// signals that interrupt waiting.  Signals are caught from creation so that
+// none arriving while setting up pid files are lost.  Signals ignored when
+// waitn started, as non-interactive shells ignore SIGINT and SIGQUIT for
+// background jobs, remain ignored.
+type signalHandler struct {
+	c chan os.Signal
+}
+
+func notifySignals(sigs []syscall.Signal) *signalHandler {
+	h := &signalHandler{c: make(chan os.Signal, 1)}
+	if len(sigs) == 0 {
+		return h
+	}
+	var osSigs []os.Signal
+	for _, sig := range sigs {
+		if !signal.Ignored(sig) {
+			osSigs = append(osSigs, sig)
+		}
+	}
+	if len(osSigs) > 0 {
+		signal.Notify(h.c, osSigs...)
+	}
+	return h
+}
+
+// returns a context that is canceled on the first signal with a
+// *waitn.ExitError cause for that signal, and a function to cancel that
+// context (should be deferred).  If forward then the signal is first sent to
+// all processes of pidFiles.
+func (h *signalHandler) watch(ctx context.Context,
+	pidFiles []waitn.PidFile, forward bool) (
+	context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		select {
+		case s := <-h.c:
+			sig := s.(syscall.Signal)
+			if forward {
+				if err := waitn.SignalPidFiles(pidFiles, sig); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+			}
+			cancel(waitn.SignalErr(sig))
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(nil) }
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+// SIGINT interrupts waiting unless it was ignored when waitn started, as for
+// background jobs of non-interactive shells
+func TestIgnoredSignals(t *testing.T) {
+	require := require.New(t)
+
+	running := exec.Command("sleep", "10")
+	require.NoError(running.Start())
+	defer running.Wait()
+	defer running.Process.Kill()
+	pid := strconv.Itoa(running.Process.Pid)
+
+	for trap, exitCode := range map[string]int{
+		"":             waitn.SIGNAL_EXIT_BASE + int(syscall.SIGINT),
+		`trap "" INT;`: waitn.TIMEOUT_ERROR,
+	} {
+		cmd := exec.Command("sh", "-c", trap+` exec "$0" "$@"`,
+			waitnBin, "-t", "1000", pid)
+		require.NoError(cmd.Start())
+		time.Sleep(200 * time.Millisecond)
+		require.NoError(cmd.Process.Signal(syscall.SIGINT))
+		err := cmd.Wait()
+		var exitErr *exec.ExitError
+		require.True(errors.As(err, &exitErr), err)
+		require.Equal(exitCode, exitErr.ExitCode(), trap)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/waitn"
+)
+
+// waitn supervise -watch [<label>=]<pid>... -- <command>...
+func supervise(args []string) {
+	fs := flag.NewFlagSet("supervise", flag.ExitOnError)
+	var watch []string
+	watchUsage := "[<label>=]<pid> whose exit terminates the command.  May be repeated"
+	fs.Func("watch", watchUsage, func(s string) error {
+		watch = append(watch, s)
+		return nil
+	})
+	var errorOnUnknown waitn.UnknownPolicy
+	errorOnUnknownFlag(fs, &errorOnUnknown)
+	var timeout timeoutFlags
+	timeoutFlag(fs, &timeout, "Zero implies no timeout")
+	var json bool
+	jsonFlag(fs, &json)
+	var usage bool
+	usageFlag(fs, &usage)
+	backend := backendFlag(fs)
+	signals := signalsFlag(fs)
+	graceUsage := "time after SIGTERM to send SIGKILL when terminating the command"
+	grace := fs.Duration("grace", 10*time.Second, graceUsage)
+	restart := restartFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(
+			fs.Output(),
+			`run a command until it or any watched process exits.
+Usage: waitn supervise [-u] [-json] [-usage] [-t <timeout>]
+                       [-backend <backend>] [-signals <signals>]
+                       [-grace <duration>] [-restart <mode>]
+                       [-max-restarts <N>] [-backoff <min>..<max>]
+                       -watch [<label>=]<pid>... -- <command>...`)
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output())
+		fmt.Fprint(
+			fs.Output(),
+			`If the command exits first waitn exits with its exit code.  Otherwise the
+command is sent SIGTERM via its pidfd, and SIGKILL after -grace, once a watched
+process exits, on timeout, or on an interrupting signal.  waitn then prints the
+watched pid and exits as it would waiting for the watched pids.
+
+With -restart a command that exits is started again, with a new pid, after its
+backoff, and its exit code is printed to stderr.  waitn exits with the command's
+exit code once it is not restarted.  If a watched process exits, on timeout, or
+on an interrupting signal while waiting to restart, the command is not
+restarted.
+
+With -usage the command's final result is printed before any watched pid, as
+the label "command", its pid, its exit_code=, and the usage fields of jobs.
+Its rusage covers only its final run.
+
+If a watched pid cannot be found the command is not started.`)
+		fmt.Fprintln(fs.Output())
+	}
+	parseSubcommandFlags(fs, args)
+
+	if len(watch) == 0 || len(fs.Args()) == 0 {
+		fmt.Fprintln(os.Stderr, "supervise requires -watch and a command")
+		fs.Usage()
+		os.Exit(waitn.INPUT_ERROR)
+	}
+	policy := parseRestartPolicyOrExit(restart)
+	waitBackend := parseBackendOrExit(*backend)
+	handler := notifySignals(parseSignalsOrExit(*signals))
+	ctx, ctxCancel := timeoutContext(timeout)
+	defer ctxCancel()
+
+	targets, exitErr := waitn.ParseTargets(watch, nil)
+	out := newPrinter(json, targets)
+	out.backend = waitBackend
+	exitIfError(out, exitErr)
+
+	pidFiles, result, exitErr := waitn.SetupPidFiles(
+		waitBackend, targets, errorOnUnknown)
+	exitIfResultOrError(out, result, exitErr)
+
+	worker, err := waitn.Launch(fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		out.exit(waitn.INPUT_ERROR)
+	}
+
+	ctx, signalCancel := handler.watch(ctx, pidFiles, false)
+	defer signalCancel()
+	out.usage = usage
+	onResult := func(result waitn.SuperviseResult) {
+		if result.Restarting {
+			fmt.Fprintf(os.Stderr, "supervise: command exited %v, restart %v\n",
+				result.ExitCode, result.Restarts+1)
+		} else if usage {
+			out.printSupervised(result)
+		}
+	}
+	code, result, exitErr := waitn.Supervise(
+		ctx, waitBackend, worker, pidFiles, *grace, policy, onResult)
+	exitIfResultOrError(out, result, exitErr)
+	out.exit(code)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervise(t *testing.T) {
+	require := require.New(t)
+
+	// command exits first with its exit code
+	{
+		sleep := exec.Command("sleep", "10")
+		require.NoError(sleep.Start())
+		defer sleep.Process.Kill()
+		out, err := exec.Command(waitnBin, "supervise",
+			"-watch", strconv.Itoa(sleep.Process.Pid),
+			"--", "sh", "-c", "exit 7").Output()
+		var exitErr *exec.ExitError
+		require.True(errors.As(err, &exitErr), err)
+		require.Equal(7, exitErr.ExitCode())
+		require.Empty(out)
+	}
+
+	// watched process exits first, terminating the command
+	{
+		sleep := exec.Command("sleep", "0.1")
+		require.NoError(sleep.Start())
+		pid := strconv.Itoa(sleep.Process.Pid)
+		out, err := exec.Command(waitnBin, "supervise",
+			"-watch", "w="+pid, "--", "sleep", "10").Output()
+		require.NoError(err)
+		require.Equal("w "+pid+"\n", string(out))
+		sleep.Wait()
+	}
+
+	// with another backend
+	{
+		sleep := exec.Command("sleep", "0.1")
+		require.NoError(sleep.Start())
+		pid := strconv.Itoa(sleep.Process.Pid)
+		out, err := exec.Command(waitnBin, "supervise", "-backend", "poll",
+			"-watch", pid, "--", "sleep", "10").Output()
+		require.NoError(err)
+		require.Equal(pid+"\n", string(out))
+		sleep.Wait()
+	}
+
+	// the command restarts until the policy gives up
+	{
+		sleep := exec.Command("sleep", "10")
+		require.NoError(sleep.Start())
+		defer sleep.Process.Kill()
+		cmd := exec.Command(waitnBin, "supervise", "-restart", "on-failure",
+			"-max-restarts", "2", "-backoff", "10ms",
+			"-watch", strconv.Itoa(sleep.Process.Pid),
+			"--", "sh", "-c", "exit 3")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		var exitErr *exec.ExitError
+		require.True(errors.As(err, &exitErr), err)
+		require.Equal(3, exitErr.ExitCode())
+		require.Empty(out)
+		require.Equal(
+			"supervise: command exited 3, restart 1\nsupervise: command exited 3, restart 2\n",
+			stderr.String())
+	}
+
+	// with -usage the command's result precedes the watched pid
+	{
+		sleep := exec.Command("sleep", "0.1")
+		require.NoError(sleep.Start())
+		pid := strconv.Itoa(sleep.Process.Pid)
+		out, err := exec.Command(waitnBin, "supervise", "-usage",
+			"-watch", "w="+pid, "--", "sleep", "10").Output()
+		require.NoError(err)
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		require.Len(lines, 2)
+		require.Regexp(regexp.MustCompile(
+			`^command [0-9]+ exit_code=143 user=\S+ sys=\S+ maxrss_kib=[1-9][0-9]* `),
+			lines[0])
+		require.Equal("w "+pid, lines[1])
+		sleep.Wait()
+	}
+
+	// and in JSON when the command exits first
+	{
+		sleep := exec.Command("sleep", "10")
+		require.NoError(sleep.Start())
+		defer sleep.Process.Kill()
+		out, err := exec.Command(waitnBin, "supervise", "-usage", "-json",
+			"-watch", strconv.Itoa(sleep.Process.Pid), "--", "sh", "-c", "exit 2").Output()
+		var exitErr *exec.ExitError
+		require.True(errors.As(err, &exitErr), err)
+		require.Equal(2, exitErr.ExitCode())
+		require.Regexp(regexp.MustCompile(
+			`^\{"pid":[0-9]+,"label":"command","state":"gone","exitCode":2,"usage":\{"userMs":`),
+			string(out))
+	}
+}
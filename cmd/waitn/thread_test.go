@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/testutil"
+	"github.com/stevenpelley/waitn/internal/waitn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThread(t *testing.T) {
+	require := require.New(t)
+
+	// a thread of this test process other than the main thread
+	tid, release := testutil.StartThread(t)
+	tidStr := strconv.Itoa(tid)
+
+	err := exec.Command(waitnBin, tidStr).Run()
+	var exitErr *exec.ExitError
+	require.True(errors.As(err, &exitErr), err)
+	require.Equal(waitn.INPUT_ERROR, exitErr.ExitCode())
+
+	var out bytes.Buffer
+	cmd := exec.Command(waitnBin, "-thread", "t="+tidStr)
+	cmd.Stdout = &out
+	require.NoError(cmd.Start())
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	// waitn is still waiting
+	select {
+	case err := <-waitErr:
+		require.Fail("waitn exited before the thread", "%v: %v", err, out.String())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+	require.NoError(<-waitErr)
+	require.Equal("t "+tidStr+"\n", out.String())
+}
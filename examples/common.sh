@@ -3,11 +3,13 @@ COMMON_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 source "$COMMON_DIR/../wait.bash"
 source "$COMMON_DIR/../wait_waitn.bash"
 
-# starts a test job and adds it to associative array "pids"
+# starts a test job and adds it to array "tasks" as <task>=<pid>.  waitn
+# prints the task as the label of the finished pid, so no pid to task map is
+# needed.
 start_job() {
     local task="$1"
     local sleep_dur=$(( (($task-1)%3)+1 ))
     echo "STARTING $task, sleep $sleep_dur @${SECONDS}"
     { sleep $sleep_dur; exit $task; } &
-    pids[$!]=$task
+    tasks[$task]="$task=$!"
 }
\ No newline at end of file
@@ -4,37 +4,37 @@ source $(realpath "$SCRIPT_DIR/common.sh")
 # we want jobs that exit normally before and after we call waitn, and jobs that
 # terminate due to SIGTERM before and after waitn
 # we'll call waitn at time 3
-declare -A pids
+tasks=()
 
 { sleep 1; exit 1; } &
-pids[$!]=1
+tasks[1]="1=$!"
 
 # to be killed at time 2
 { sleep 10; exit 2; } &
 kill_at_2=$!
-pids[$kill_at_2]=2
+tasks[2]="2=$kill_at_2"
 { sleep 2; kill $kill_at_2; } &
 
 { sleep 4; exit 3; } &
-pids[$!]=3
+tasks[3]="3=$!"
 
 # to be killed at time 5
 { sleep 10; exit 4; } &
 kill_at_5=$!
-pids[$kill_at_5]=4
+tasks[4]="4=$kill_at_5"
 { sleep 5; kill $kill_at_5; } &
 
 sleep 3
 
 # same as simple.sh
 wait_for_job() {
-    local finished_pid
-    waitn -p finished_pid "${!pids[@]}"
+    local finished_task
+    waitn -l finished_task "${tasks[@]}"
     wait_ret=$?
-    echo "FINISHED ${pids[$finished_pid]} exit code $wait_ret @${SECONDS}"
-    unset pids[$finished_pid]
+    echo "FINISHED $finished_task exit code $wait_ret @${SECONDS}"
+    unset "tasks[$finished_task]"
 }
 
-while [ ${#pids[@]} -gt 0 ]; do
+while [ ${#tasks[@]} -gt 0 ]; do
     wait_for_job
 done
\ No newline at end of file
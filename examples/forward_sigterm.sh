@@ -4,37 +4,38 @@ SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 source $(realpath "$SCRIPT_DIR/common.sh")
 
 # we'll sleep 2 and then kill
-declare -A pids
+tasks=()
 # finishes prior to kill
 { sleep 1; exit 1; } &
-pids[$!]=1
+tasks[1]="1=$!"
 # still running when killed
 { sleep 3; exit 2; } &
-pids[$!]=2
+tasks[2]="2=$!"
 
 # we kill from the SIGTERM handler, so here we just skip wait waking up due to
 # signal.  We're return 1 to indicate this, but we don't actually use it.
 wait_for_job() {
-    local finished_pid
-    waitn -p finished_pid "${!pids[@]}"
+    local finished_task
+    waitn -l finished_task "${tasks[@]}"
     wait_ret=$?
     # this line is new relative to simple.sh
-    [ -z "$finished_pid" ] && return 1
-    echo "FINISHED ${pids[$finished_pid]} exit code $wait_ret @${SECONDS}"
-    unset pids[$finished_pid]
+    [ -z "$finished_task" ] && return 1
+    echo "FINISHED $finished_task exit code $wait_ret @${SECONDS}"
+    unset "tasks[$finished_task]"
 }
 
 handled_term=false
 term_handler() {
     handled_term=true
     echo "killing jobs from handler @${SECONDS}"
-    kill -TERM "${!pids[@]}"
+    # the pid follows the = of each <task>=<pid>
+    kill -TERM "${tasks[@]##*=}"
 }
 trap term_handler TERM
 
 sleep 2 && echo "killing bash! @${SECONDS}" && kill -TERM $$ &
 
-while [ ${#pids[@]} -gt 0 ]; do
+while [ ${#tasks[@]} -gt 0 ]; do
     wait_for_job
 done
 
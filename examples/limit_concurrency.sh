@@ -3,32 +3,32 @@
 SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 source $(realpath "$SCRIPT_DIR/common.sh")
 
-declare -A pids
+tasks=()
 limit=3
 remaining_tasks=($(seq 0 9))
 
-# modifies remaining_tasks and pids
+# modifies remaining_tasks and tasks
 # returns 0 if a new task was started and 1 otherwise.
 # this does not test the concurrency limit
 start_task_if_remaining() {
     [ "${#remaining_tasks[@]}" -eq 0 ] && return 1
     task=${remaining_tasks[0]}
     remaining_tasks=("${remaining_tasks[@]:1}")
-    # start job, populate $pids
+    # start job, populate $tasks
     start_job $task
 }
 
 # identical to simple.sh
 wait_for_job() {
-    local finished_pid
-    waitn -p finished_pid "${!pids[@]}"
+    local finished_task
+    waitn -l finished_task "${tasks[@]}"
     wait_ret=$?
-    echo "FINISHED ${pids[$finished_pid]} exit code $wait_ret @${SECONDS}"
-    unset pids[$finished_pid]
+    echo "FINISHED $finished_task exit code $wait_ret @${SECONDS}"
+    unset "tasks[$finished_task]"
 }
 
-while [ ${#remaining_tasks[@]} -gt 0 ] || [ ${#pids[@]} -gt 0 ]; do
+while [ ${#remaining_tasks[@]} -gt 0 ] || [ ${#tasks[@]} -gt 0 ]; do
     # start processes until we get up to the limit
-    while [ ${#pids[@]} -lt $limit ] && start_task_if_remaining ; do : ; done
+    while [ ${#tasks[@]} -lt $limit ] && start_task_if_remaining ; do : ; done
     wait_for_job
 done
\ No newline at end of file
@@ -0,0 +1,39 @@
+#!/bin/sh
+# runs under sh (e.g., dash), bash, and zsh using the functions printed by
+# "waitn shell-init".  Set WAITN if waitn is not in PATH.
+WAITN=${WAITN:-waitn}
+if [ -n "$ZSH_VERSION" ]; then
+    # split $pids on whitespace as sh does
+    setopt sh_word_split
+    eval "$("$WAITN" shell-init zsh)"
+elif [ -n "$BASH_VERSION" ]; then
+    eval "$("$WAITN" shell-init bash)"
+else
+    eval "$("$WAITN" shell-init sh)"
+fi
+
+# no arrays in sh; pids is a space separated list
+pids=
+for task in 3 1 2; do
+    { sleep "0.$((task * 2))"; exit "$task"; } &
+    pids="$pids $!"
+done
+
+while [ -n "$pids" ]; do
+    waitn_wait -p finished_pid $pids
+    echo "FINISHED exit code $?"
+    remaining=
+    for pid in $pids; do
+        [ "$pid" = "$finished_pid" ] || remaining="$remaining $pid"
+    done
+    pids=$remaining
+done
+
+# a trapped signal interrupts waitn_wait as it does wait
+trap 'echo TRAPPED' USR1
+sleep 10 &
+long_pid=$!
+{ sleep 0.2; kill -USR1 $$; } &
+waitn_wait -p finished_pid "$long_pid"
+echo "INTERRUPTED exit code $? pid '$finished_pid'"
+kill "$long_pid"
@@ -3,20 +3,20 @@
 SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 source $(realpath "$SCRIPT_DIR/common.sh")
 
-declare -A pids
-# start jobs, populate $pids
+tasks=()
+# start jobs, populate $tasks
 for task in {1..3}; do
     start_job $task
 done
 
 wait_for_job() {
-    local finished_pid
-    waitn -p finished_pid "${!pids[@]}"
+    local finished_task
+    waitn -l finished_task "${tasks[@]}"
     wait_ret=$?
-    echo "FINISHED ${pids[$finished_pid]} exit code $wait_ret @${SECONDS}"
-    unset pids[$finished_pid]
+    echo "FINISHED $finished_task exit code $wait_ret @${SECONDS}"
+    unset "tasks[$finished_task]"
 }
 
-while [ ${#pids[@]} -gt 0 ]; do
+while [ ${#tasks[@]} -gt 0 ]; do
     wait_for_job
 done
\ No newline at end of file
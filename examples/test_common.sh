@@ -3,8 +3,8 @@
 SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 source "$SCRIPT_DIR/common.sh"
 
-declare -A pids
+tasks=()
 start_job 1
 
-waitn -p finished_pid "${!pids[@]}"
-echo "finished pid: $finished_pid exit: $? @${SECONDS}"
\ No newline at end of file
+waitn -p finished_pid -l finished_task "${tasks[@]}"
+echo "finished $finished_task pid: $finished_pid exit: $? @${SECONDS}"
\ No newline at end of file
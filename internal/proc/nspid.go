@@ -0,0 +1,98 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// a pid namespace, identified by the device and inode of its /proc/<pid>/ns/pid
+// file
+type PidNamespace struct {
+	Dev uint64
+	Ino uint64
+}
+
+// the pid namespace of the file at path, typically /proc/<pid>/ns/pid or a
+// bind mount of one
+func PidNamespaceOf(path string) (PidNamespace, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return PidNamespace{}, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	return PidNamespace{Dev: st.Dev, Ino: st.Ino}, nil
+}
+
+// the pids of a process, or thread, from the NSpid line of /proc/<pid>/status.
+// The first is its pid in the pid namespace of /proc and the last its pid in
+// its own pid namespace, with one pid for each nested namespace between.
+// The caller must ensure that pid still refers to the intended process once
+// this returns.
+func NSpids(pid int) ([]int, error) {
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	return parseNSpids(string(status))
+}
+
+func parseNSpids(status string) ([]int, error) {
+	parsed, err := parseStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.NSpid == nil {
+		// NSpid was added in Linux 4.1
+		return nil, fmt.Errorf("read proc status: no NSpid")
+	}
+	return parsed.NSpid, nil
+}
+
+// the pids, in the pid namespace of /proc, of every visible process whose own
+// pid namespace is ns, keyed by their pids in ns.  Processes in namespaces
+// nested within ns are not included.  Processes that exit while reading /proc,
+// or whose namespace we may not inspect, are skipped.
+func HostPids(ns PidNamespace) (map[int]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	hostPids := make(map[int]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		procNs, err := PidNamespaceOf(fmt.Sprintf("/proc/%v/ns/pid", pid))
+		if err != nil || procNs != ns {
+			continue
+		}
+		nsPids, err := NSpids(pid)
+		if err != nil {
+			continue
+		}
+		hostPids[nsPids[len(nsPids)-1]] = pid
+	}
+	return hostPids, nil
+}
+
+// whether /proc is mounted for our own pid namespace, so that its pids are
+// ours.  Under /proc of another namespace, such as a host's shared with a
+// container, /proc/self names our pid there or nothing.
+func IsOwnPidNamespace() bool {
+	self, err := os.Readlink("/proc/self")
+	return err == nil && self == strconv.Itoa(os.Getpid())
+}
+
+// whether /proc lists pid.  Returns an error satisfying
+// errors.Is(err, os.ErrPermission) if we may not look.
+func Listed(pid int) (bool, error) {
+	_, err := os.Stat(fmt.Sprintf("/proc/%v", pid))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
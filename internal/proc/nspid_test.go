@@ -0,0 +1,49 @@
+package proc
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNSpids(t *testing.T) {
+	require := require.New(t)
+
+	pids, err := parseNSpids("Name:\tsleep\nNSpid:\t4742\t17\t2\nPPid:\t1\n")
+	require.NoError(err)
+	require.Equal([]int{4742, 17, 2}, pids)
+
+	_, err = parseNSpids("Name:\tsleep\n")
+	require.Error(err)
+	_, err = parseNSpids("NSpid:\t4742\tx\n")
+	require.Error(err)
+}
+
+func TestHostPids(t *testing.T) {
+	require := require.New(t)
+
+	ns, err := PidNamespaceOf("/proc/self/ns/pid")
+	require.NoError(err)
+	hostPids, err := HostPids(ns)
+	require.NoError(err)
+	// /proc is assumed to be of our own namespace
+	require.Equal(os.Getpid(), hostPids[os.Getpid()])
+
+	_, err = PidNamespaceOf("/proc/does-not-exist/ns/pid")
+	require.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestListed(t *testing.T) {
+	require := require.New(t)
+
+	// /proc is assumed to be of our own namespace
+	require.True(IsOwnPidNamespace())
+	listed, err := Listed(os.Getpid())
+	require.NoError(err)
+	require.True(listed)
+	// larger than any pid_max
+	listed, err = Listed(1 << 30)
+	require.NoError(err)
+	require.False(listed)
+}
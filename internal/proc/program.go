@@ -0,0 +1,27 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// identifies the program a process runs: its executable and command name
+// separated by a newline.  This changes when the process execs, unless it
+// execs the same executable under the same name.  The executable is empty if
+// we may not read it, as for other users' processes.  The caller must ensure
+// that pid still refers to the intended process once this returns.
+func Program(pid int) (string, error) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%v/exe", pid))
+	if errors.Is(err, os.ErrPermission) {
+		exe = ""
+	} else if err != nil {
+		return "", err
+	}
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%v/comm", pid))
+	if err != nil {
+		return "", err
+	}
+	return exe + "\n" + strings.TrimSuffix(string(comm), "\n"), nil
+}
@@ -0,0 +1,32 @@
+package proc
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgram(t *testing.T) {
+	require := require.New(t)
+
+	self, err := Program(os.Getpid())
+	require.NoError(err)
+	exe, err := os.Executable()
+	require.NoError(err)
+	require.True(strings.HasPrefix(self, exe+"\n"), self)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	sleep, err := Program(cmd.Process.Pid)
+	require.NoError(err)
+	require.True(strings.HasSuffix(sleep, "\nsleep"), sleep)
+	require.NotEqual(self, sleep)
+
+	_, err = Program(1 << 30)
+	require.ErrorIs(err, os.ErrNotExist)
+}
@@ -0,0 +1,43 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// units of times in /proc/<pid>/stat.  This is USER_HZ, which the kernel fixes
+// at 100 for userspace on every architecture regardless of its internal HZ.
+const CLK_TCK = 100
+
+// the time since boot, on CLOCK_BOOTTIME, when the process started.  The
+// resolution is 1/CLK_TCK.  The caller must ensure that pid still refers to
+// the intended process once this returns.
+func StartTime(pid int) (time.Duration, error) {
+	s, err := os.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	ticks, err := readStatStarttime(string(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ticks) * (time.Second / CLK_TCK), nil
+}
+
+// the current time since boot, on CLOCK_BOOTTIME
+func BootTime() time.Duration {
+	return ClockTime(unix.CLOCK_BOOTTIME)
+}
+
+// the current time on clock, such as unix.CLOCK_MONOTONIC, as from
+// clock_gettime(2)
+func ClockTime(clock int32) time.Duration {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(clock, &ts); err != nil {
+		panic(fmt.Sprintf("clock_gettime(%v): %v", clock, err))
+	}
+	return time.Duration(ts.Nano())
+}
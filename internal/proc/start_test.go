@@ -0,0 +1,37 @@
+package proc
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartTime(t *testing.T) {
+	require := require.New(t)
+
+	start, err := StartTime(os.Getpid())
+	require.NoError(err)
+	now := BootTime()
+	require.Greater(start, time.Duration(0))
+	require.LessOrEqual(start, now)
+	// this test process started recently
+	require.Less(now-start, time.Hour)
+
+	_, err = StartTime(1 << 30)
+	require.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestReadStatStarttime(t *testing.T) {
+	require := require.New(t)
+
+	// the command name may contain spaces and parentheses
+	stat := "42 (a) b (c)) S 1 42 42 0 -1 4194560 100 0 0 0 0 0 0 0 20 0 1 0 12345 1000 100"
+	ticks, err := readStatStarttime(stat)
+	require.NoError(err)
+	require.Equal(uint64(12345), ticks)
+
+	_, err = readStatStarttime("42 (a S 1")
+	require.Error(err)
+}
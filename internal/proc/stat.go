@@ -1,6 +1,6 @@
 package proc
 
-// This is currently unreferenced code.
+// IsCorrectProcess is currently unreferenced code.
 // It was intended to provide a safe means of determining if a pid refers to the
 // correct process (as pids may be reused) by using the pids starttime read from
 // /proc/pid/stat.  It got complicated.  There are enough other cases in linux
@@ -45,34 +45,155 @@ func IsCorrectProcess(pid int, processStartTime uint64, globalStartTime uint64,
 }
 
 func readStatStarttime(contents string) (uint64, error) {
-	// get the starttime from the stat file
-	// it is the 22nd field.  The 2nd field is the filename of the executable in
-	// parenthesis.  It might have spaces and nested parenthesis and is the
-	// only field that may be non-alphanumeric.  We will search for the
-	// right-most ") " and assume the 3rd field starts immediately after.  Then
-	// we find the 22nd overall field.
+	stat, err := parseStat(contents)
+	if err != nil {
+		return 0, fmt.Errorf("read proc stat starttime: %w", err)
+	}
+	return stat.StartTime, nil
+}
+
+// the fields of /proc/<pid>/stat, see proc(5), named as there.  Times are in
+// units of 1/CLK_TCK and StartTime is since boot.  Fields after StartTime are
+// zero where the kernel predates them, and addresses and wait channels are
+// zero unless we may ptrace the process.
+type Stat struct {
+	Pid int
+	// the command name, truncated to 15 bytes.  It may contain any character.
+	Comm string
+	// a state character such as R, S, or STATE_ZOMBIE
+	State       byte
+	Ppid        int
+	Pgrp        int
+	Session     int
+	TtyNr       int
+	Tpgid       int
+	Flags       uint64
+	MinFlt      uint64
+	CMinFlt     uint64
+	MajFlt      uint64
+	CMajFlt     uint64
+	UTime       uint64
+	STime       uint64
+	CUTime      int64
+	CSTime      int64
+	Priority    int64
+	Nice        int64
+	NumThreads  int64
+	ItRealValue int64
+	StartTime   uint64
+	// virtual memory size in bytes
+	VSize uint64
+	// resident set size in pages
+	RSS                 int64
+	RSSLim              uint64
+	StartCode           uint64
+	EndCode             uint64
+	StartStack          uint64
+	KStkESP             uint64
+	KStkEIP             uint64
+	Signal              uint64
+	Blocked             uint64
+	SigIgnore           uint64
+	SigCatch            uint64
+	WChan               uint64
+	NSwap               uint64
+	CNSwap              uint64
+	ExitSignal          int
+	Processor           int
+	RTPriority          uint64
+	Policy              uint64
+	DelayAcctBlkioTicks uint64
+	GuestTime           uint64
+	CGuestTime          int64
+	StartData           uint64
+	EndData             uint64
+	StartBrk            uint64
+	ArgStart            uint64
+	ArgEnd              uint64
+	EnvStart            uint64
+	EnvEnd              uint64
+	// the wait status of a zombie as reported by waitpid(2), see
+	// unix.WaitStatus.  Linux 3.5+.
+	ExitCode int
+}
 
-	lastIdx := strings.LastIndex(contents, ") ")
-	if lastIdx == -1 {
-		return 0, fmt.Errorf(
-			"read proc stat starttime: \") \" not found (expected in field 2 of file).  Contents: %v",
+// read /proc/<pid>/stat.  Returns an error satisfying
+// errors.Is(err, os.ErrNotExist) if there is no such process.  The caller must
+// ensure that pid still refers to the intended process once this returns.
+func ReadStat(pid int) (Stat, error) {
+	s, err := os.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return Stat{}, err
+	}
+	return parseStat(string(s))
+}
+
+func parseStat(contents string) (Stat, error) {
+	// The 2nd field is the command name in parenthesis.  It might have spaces
+	// and nested parenthesis and is the only field that may be
+	// non-alphanumeric.  We will search for the right-most ") " and assume
+	// the 3rd field starts immediately after.
+	var stat Stat
+	pid, rest, found := strings.Cut(contents, " (")
+	lastIdx := strings.LastIndex(rest, ") ")
+	if !found || lastIdx == -1 {
+		return Stat{}, fmt.Errorf(
+			"\") \" not found (expected in field 2 of file).  Contents: %v",
 			contents)
 	}
-	fieldsThreeAndUp := contents[lastIdx+2:]
-	fields := strings.Split(fieldsThreeAndUp, " ")
+	var err error
+	stat.Pid, err = strconv.Atoi(pid)
+	if err != nil {
+		return Stat{}, fmt.Errorf(
+			"read proc stat field 1.  Contents: %v: %w", contents, err)
+	}
+	stat.Comm = rest[:lastIdx]
+
+	fields := strings.Fields(rest[lastIdx+2:])
+	// starttime, field 22, is the last field every kernel has
 	if len(fields) < 20 {
-		return 0, fmt.Errorf(
-			"read proc stat starttime: fewer fields than expected found after close parenthesis (assumed to be field 2).  Contents: %v",
+		return Stat{}, fmt.Errorf(
+			"fewer fields than expected found after close parenthesis (assumed to be field 2).  Contents: %v",
 			contents)
 	}
+	if len(fields[0]) != 1 || !isStateChar(fields[0][0]) {
+		return Stat{}, fmt.Errorf(
+			"read proc stat field 3: not a state.  Contents: %v", contents)
+	}
+	stat.State = fields[0][0]
 
-	s := fields[19]
-	statStartTime, err := strconv.ParseUint(s, 10, 0)
-	if err != nil {
-		return 0, fmt.Errorf(
-			"read proc stat starttime: parsing starttime string.  Contents: %v: %w",
-			contents,
-			err)
+	// fields 4 and up
+	ptrs := []any{&stat.Ppid, &stat.Pgrp, &stat.Session, &stat.TtyNr,
+		&stat.Tpgid, &stat.Flags, &stat.MinFlt, &stat.CMinFlt, &stat.MajFlt,
+		&stat.CMajFlt, &stat.UTime, &stat.STime, &stat.CUTime, &stat.CSTime,
+		&stat.Priority, &stat.Nice, &stat.NumThreads, &stat.ItRealValue,
+		&stat.StartTime, &stat.VSize, &stat.RSS, &stat.RSSLim, &stat.StartCode,
+		&stat.EndCode, &stat.StartStack, &stat.KStkESP, &stat.KStkEIP,
+		&stat.Signal, &stat.Blocked, &stat.SigIgnore, &stat.SigCatch,
+		&stat.WChan, &stat.NSwap, &stat.CNSwap, &stat.ExitSignal,
+		&stat.Processor, &stat.RTPriority, &stat.Policy,
+		&stat.DelayAcctBlkioTicks, &stat.GuestTime, &stat.CGuestTime,
+		&stat.StartData, &stat.EndData, &stat.StartBrk, &stat.ArgStart,
+		&stat.ArgEnd, &stat.EnvStart, &stat.EnvEnd, &stat.ExitCode}
+	for i, field := range fields[1:min(len(fields), len(ptrs)+1)] {
+		var err error
+		switch p := ptrs[i].(type) {
+		case *int:
+			*p, err = strconv.Atoi(field)
+		case *int64:
+			*p, err = strconv.ParseInt(field, 10, 64)
+		case *uint64:
+			*p, err = strconv.ParseUint(field, 10, 64)
+		}
+		if err != nil {
+			return Stat{}, fmt.Errorf(
+				"read proc stat field %v.  Contents: %v: %w", i+4, contents, err)
+		}
 	}
-	return statStartTime, nil
+	return stat, nil
+}
+
+// process state characters are letters, see proc(5)
+func isStateChar(c byte) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z')
 }
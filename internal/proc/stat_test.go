@@ -0,0 +1,103 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const testStat = "7977 (a) b (c)) Z 7973 7977 7973 34816 -1 4194304 81 2 3 4 5 6 -7 -8 20 -5 1 0 108354 2703360 309 18446744073709551615 1 2 3 0 0 0 0 0 0 0 0 0 17 3 0 0 9 10 11 12 13 14 15 16 17 18 256\n"
+
+func TestParseStat(t *testing.T) {
+	require := require.New(t)
+
+	stat, err := parseStat(testStat)
+	require.NoError(err)
+	require.Equal(Stat{
+		Pid: 7977, Comm: "a) b (c)", State: STATE_ZOMBIE, Ppid: 7973,
+		Pgrp: 7977, Session: 7973, TtyNr: 34816, Tpgid: -1, Flags: 4194304,
+		MinFlt: 81, CMinFlt: 2, MajFlt: 3, CMajFlt: 4, UTime: 5, STime: 6,
+		CUTime: -7, CSTime: -8, Priority: 20, Nice: -5, NumThreads: 1,
+		StartTime: 108354, VSize: 2703360, RSS: 309,
+		RSSLim: 18446744073709551615, StartCode: 1, EndCode: 2,
+		StartStack: 3, ExitSignal: 17, Processor: 3, DelayAcctBlkioTicks: 9,
+		GuestTime: 10, CGuestTime: 11, StartData: 12, EndData: 13,
+		StartBrk: 14, ArgStart: 15, ArgEnd: 16, EnvStart: 17, EnvEnd: 18,
+		ExitCode: 256}, stat)
+	require.Equal(1, unix.WaitStatus(stat.ExitCode).ExitStatus())
+
+	// fields of later kernels are zero
+	fields := strings.Fields(testStat)
+	stat, err = parseStat(strings.Join(fields[:25], " "))
+	require.NoError(err)
+	require.EqualValues(108354, stat.StartTime)
+	require.Zero(stat.ExitCode)
+
+	for _, contents := range []string{
+		"7977 (a S 1",
+		"x (a) S" + testStat[strings.Index(testStat, ") Z")+3:],
+		strings.Replace(testStat, ") Z", ") ZZ", 1),
+		strings.Replace(testStat, ") Z", ") 1", 1),
+		strings.Replace(testStat, " -1 ", " x ", 1),
+		strings.Join(fields[:23], " "),
+	} {
+		_, err = parseStat(contents)
+		require.Error(err, contents)
+	}
+}
+
+func TestReadStat(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	stat, err := ReadStat(cmd.Process.Pid)
+	require.NoError(err)
+	require.Equal(cmd.Process.Pid, stat.Pid)
+	require.Equal("sleep", stat.Comm)
+	require.Equal(os.Getpid(), stat.Ppid)
+	require.EqualValues(1, stat.NumThreads)
+
+	_, err = ReadStat(1 << 30)
+	require.ErrorIs(err, os.ErrNotExist)
+}
+
+// format stat as the kernel does
+func formatStat(stat Stat) string {
+	return fmt.Sprintf("%d (%s) %c"+strings.Repeat(" %d", 49)+"\n",
+		stat.Pid, stat.Comm, stat.State, stat.Ppid, stat.Pgrp, stat.Session,
+		stat.TtyNr, stat.Tpgid, stat.Flags, stat.MinFlt, stat.CMinFlt,
+		stat.MajFlt, stat.CMajFlt, stat.UTime, stat.STime, stat.CUTime,
+		stat.CSTime, stat.Priority, stat.Nice, stat.NumThreads,
+		stat.ItRealValue, stat.StartTime, stat.VSize, stat.RSS, stat.RSSLim,
+		stat.StartCode, stat.EndCode, stat.StartStack, stat.KStkESP,
+		stat.KStkEIP, stat.Signal, stat.Blocked, stat.SigIgnore, stat.SigCatch,
+		stat.WChan, stat.NSwap, stat.CNSwap, stat.ExitSignal, stat.Processor,
+		stat.RTPriority, stat.Policy, stat.DelayAcctBlkioTicks, stat.GuestTime,
+		stat.CGuestTime, stat.StartData, stat.EndData, stat.StartBrk,
+		stat.ArgStart, stat.ArgEnd, stat.EnvStart, stat.EnvEnd, stat.ExitCode)
+}
+
+// whatever parses is formatted and parsed again unchanged
+func FuzzParseStat(f *testing.F) {
+	f.Add(testStat)
+	f.Add("1 (a) S 0 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 5 0")
+	f.Add("1 () ) R 0")
+	f.Fuzz(func(t *testing.T, contents string) {
+		stat, err := parseStat(contents)
+		if err != nil {
+			return
+		}
+		reparsed, err := parseStat(formatStat(stat))
+		require.NoError(t, err)
+		require.Equal(t, stat, reparsed)
+	})
+}
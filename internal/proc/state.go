@@ -0,0 +1,60 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+)
+
+// process states from /proc/<pid>/stat, see proc(5)
+const (
+	STATE_ZOMBIE = 'Z'
+	STATE_DEAD   = 'X'
+)
+
+// the state of a process, or thread, from /proc/<pid>/stat
+type State struct {
+	// a state character such as R, S, or STATE_ZOMBIE
+	State byte
+	// the start time in units of 1/CLK_TCK since boot.  A process that reuses
+	// the pid has a later start time.
+	StartTicks uint64
+}
+
+// read the state of pid.  Returns an error satisfying
+// errors.Is(err, os.ErrNotExist) if there is no such process.
+func ReadState(pid int) (State, error) {
+	s, err := os.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return State{}, err
+	}
+	return parseState(string(s))
+}
+
+func parseState(stat string) (State, error) {
+	parsed, err := parseStat(stat)
+	if err != nil {
+		return State{}, fmt.Errorf("read proc stat state: %w", err)
+	}
+	return State{State: parsed.State, StartTicks: parsed.StartTime}, nil
+}
+
+// the thread group id of a process, or thread, from /proc/<pid>/status.  This
+// is pid unless pid is a thread other than its thread group's leader.
+func Tgid(pid int) (int, error) {
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	return parseTgid(string(status))
+}
+
+func parseTgid(status string) (int, error) {
+	parsed, err := parseStatus(status)
+	if err != nil {
+		return 0, err
+	}
+	if parsed.Tgid == 0 {
+		return 0, fmt.Errorf("read proc status: no Tgid")
+	}
+	return parsed.Tgid, nil
+}
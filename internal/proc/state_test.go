@@ -0,0 +1,49 @@
+package proc
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseState(t *testing.T) {
+	require := require.New(t)
+
+	stat := "42 (a) b (c)) Z 1 42 42 0 -1 4194560 100 0 0 0 0 0 0 0 20 0 1 0 12345 1000 100"
+	state, err := parseState(stat)
+	require.NoError(err)
+	require.Equal(State{State: STATE_ZOMBIE, StartTicks: 12345}, state)
+
+	_, err = parseState("42 (a Z 1")
+	require.Error(err)
+}
+
+func TestReadState(t *testing.T) {
+	require := require.New(t)
+
+	state, err := ReadState(os.Getpid())
+	require.NoError(err)
+	require.Equal(byte('R'), state.State)
+	ticks, err := StartTime(os.Getpid())
+	require.NoError(err)
+	require.EqualValues(ticks/(1e9/CLK_TCK), state.StartTicks)
+
+	_, err = ReadState(1 << 30)
+	require.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestParseTgid(t *testing.T) {
+	require := require.New(t)
+
+	tgid, err := parseTgid("Name:\tsleep\nTgid:\t4742\nPid:\t4743\n")
+	require.NoError(err)
+	require.Equal(4742, tgid)
+
+	_, err = parseTgid("Name:\tsleep\n")
+	require.Error(err)
+
+	tgid, err = Tgid(os.Getpid())
+	require.NoError(err)
+	require.Equal(os.Getpid(), tgid)
+}
@@ -0,0 +1,158 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// fields of /proc/<pid>/status, see proc(5).  Fields the kernel does not
+// report, such as memory sizes of kernel threads or NSpid before Linux 4.1,
+// are zero or nil.
+type Status struct {
+	// the command name, with backslashes and newlines escaped
+	Name string
+	// a state character such as R, S, or STATE_ZOMBIE
+	State byte
+	// thread group id.  This is Pid unless it is a thread other than its
+	// thread group's leader.
+	Tgid      int
+	Pid       int
+	PPid      int
+	TracerPid int
+	// real, effective, saved set, and filesystem ids
+	Uid    [4]uint32
+	Gid    [4]uint32
+	Groups []uint32
+	// ids in the pid namespace of /proc followed by those in each nested pid
+	// namespace down to the process's own
+	NStgid []int
+	NSpid  []int
+	NSpgid []int
+	NSsid  []int
+	// memory sizes in KiB: peak and current virtual memory and peak and
+	// current resident set
+	VmPeak  int64
+	VmSize  int64
+	VmHWM   int64
+	VmRSS   int64
+	Threads int
+	// context switches
+	VoluntaryCtxtSwitches    int64
+	NonvoluntaryCtxtSwitches int64
+}
+
+// read /proc/<pid>/status.  Returns an error satisfying
+// errors.Is(err, os.ErrNotExist) if there is no such process.  The caller must
+// ensure that pid still refers to the intended process once this returns.
+func ReadStatus(pid int) (Status, error) {
+	s, err := os.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		return Status{}, err
+	}
+	return parseStatus(string(s))
+}
+
+func parseStatus(contents string) (Status, error) {
+	// lines are "<key>:\t<value>", sizes with a kB suffix.  Groups may be too
+	// long for a bufio.Scanner.
+	var status Status
+	for _, line := range strings.Split(contents, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		var err error
+		switch key {
+		case "Name":
+			status.Name = strings.TrimPrefix(value, "\t")
+		case "State":
+			value = strings.TrimSpace(value)
+			if len(value) == 0 || !isStateChar(value[0]) {
+				err = fmt.Errorf("not a state: %q", value)
+			} else {
+				status.State = value[0]
+			}
+		case "Tgid":
+			status.Tgid, err = strconv.Atoi(strings.TrimSpace(value))
+		case "Pid":
+			status.Pid, err = strconv.Atoi(strings.TrimSpace(value))
+		case "PPid":
+			status.PPid, err = strconv.Atoi(strings.TrimSpace(value))
+		case "TracerPid":
+			status.TracerPid, err = strconv.Atoi(strings.TrimSpace(value))
+		case "Threads":
+			status.Threads, err = strconv.Atoi(strings.TrimSpace(value))
+		case "Uid":
+			err = parseIds(value, status.Uid[:])
+		case "Gid":
+			err = parseIds(value, status.Gid[:])
+		case "Groups":
+			if n := len(strings.Fields(value)); n > 0 {
+				status.Groups = make([]uint32, n)
+				err = parseIds(value, status.Groups)
+			}
+		case "NStgid":
+			status.NStgid, err = parseInts(value)
+		case "NSpid":
+			status.NSpid, err = parseInts(value)
+		case "NSpgid":
+			status.NSpgid, err = parseInts(value)
+		case "NSsid":
+			status.NSsid, err = parseInts(value)
+		case "VmPeak":
+			status.VmPeak, err = parseKiB(value)
+		case "VmSize":
+			status.VmSize, err = parseKiB(value)
+		case "VmHWM":
+			status.VmHWM, err = parseKiB(value)
+		case "VmRSS":
+			status.VmRSS, err = parseKiB(value)
+		case "voluntary_ctxt_switches":
+			status.VoluntaryCtxtSwitches, err = strconv.ParseInt(
+				strings.TrimSpace(value), 10, 64)
+		case "nonvoluntary_ctxt_switches":
+			status.NonvoluntaryCtxtSwitches, err = strconv.ParseInt(
+				strings.TrimSpace(value), 10, 64)
+		}
+		if err != nil {
+			return Status{}, fmt.Errorf("read proc status %v: %w", key, err)
+		}
+	}
+	return status, nil
+}
+
+// parse exactly len(ids) whitespace separated ids
+func parseIds(value string, ids []uint32) error {
+	fields := strings.Fields(value)
+	if len(fields) != len(ids) {
+		return fmt.Errorf("expected %v ids: %q", len(ids), value)
+	}
+	for i, field := range fields {
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return err
+		}
+		ids[i] = uint32(id)
+	}
+	return nil
+}
+
+// parse whitespace separated ints, nil if there are none
+func parseInts(value string) ([]int, error) {
+	var ints []int
+	for _, field := range strings.Fields(value) {
+		i, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+func parseKiB(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), " kB")
+	return strconv.ParseInt(value, 10, 64)
+}
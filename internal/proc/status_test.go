@@ -0,0 +1,110 @@
+package proc
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testStatus = `Name:	a b
+Umask:	0022
+State:	Z (zombie)
+Tgid:	4742
+Ngid:	0
+Pid:	4743
+PPid:	1
+TracerPid:	0
+Uid:	1000	1001	1002	1003
+Gid:	100	101	102	103
+FDSize:	64
+Groups:	4 24 27 
+NStgid:	4742	17
+NSpid:	4743	18
+NSpgid:	4742	17
+NSsid:	4700	1
+VmPeak:	    2640 kB
+VmSize:	    2632 kB
+VmHWM:	    1440 kB
+VmRSS:	    1436 kB
+Threads:	3
+SigQ:	0/24001
+voluntary_ctxt_switches:	5
+nonvoluntary_ctxt_switches:	6
+`
+
+func TestParseStatus(t *testing.T) {
+	require := require.New(t)
+
+	status, err := parseStatus(testStatus)
+	require.NoError(err)
+	require.Equal(Status{
+		Name: "a b", State: STATE_ZOMBIE, Tgid: 4742, Pid: 4743, PPid: 1,
+		Uid:    [4]uint32{1000, 1001, 1002, 1003},
+		Gid:    [4]uint32{100, 101, 102, 103},
+		Groups: []uint32{4, 24, 27},
+		NStgid: []int{4742, 17}, NSpid: []int{4743, 18},
+		NSpgid: []int{4742, 17}, NSsid: []int{4700, 1},
+		VmPeak: 2640, VmSize: 2632, VmHWM: 1440, VmRSS: 1436, Threads: 3,
+		VoluntaryCtxtSwitches: 5, NonvoluntaryCtxtSwitches: 6}, status)
+
+	// kernel threads have no memory sizes and may have no groups
+	status, err = parseStatus("Name:\tkthreadd\nGroups:\t\nThreads:\t1\n")
+	require.NoError(err)
+	require.Equal(Status{Name: "kthreadd", Threads: 1}, status)
+
+	for _, contents := range []string{
+		strings.Replace(testStatus, "1000\t", "", 1),
+		strings.Replace(testStatus, "Groups:\t4", "Groups:\t-4", 1),
+		strings.Replace(testStatus, "4743\t18", "4743\tx", 1),
+		strings.Replace(testStatus, "1440 kB", "lots kB", 1),
+		strings.Replace(testStatus, "Z (zombie)", "", 1),
+	} {
+		_, err = parseStatus(contents)
+		require.Error(err, contents)
+	}
+}
+
+func TestReadStatus(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	status, err := ReadStatus(cmd.Process.Pid)
+	require.NoError(err)
+	require.Equal("sleep", status.Name)
+	require.Equal(cmd.Process.Pid, status.Pid)
+	require.Equal(cmd.Process.Pid, status.Tgid)
+	require.Equal(os.Getpid(), status.PPid)
+	require.Equal(uint32(os.Getuid()), status.Uid[0])
+	require.Equal(uint32(os.Getgid()), status.Gid[0])
+	require.Equal(1, status.Threads)
+
+	_, err = ReadStatus(1 << 30)
+	require.ErrorIs(err, os.ErrNotExist)
+}
+
+// parsing never panics, and status parsed from fields present is consistent
+func FuzzParseStatus(f *testing.F) {
+	f.Add(testStatus)
+	f.Add("Groups:\t\nNSpid:\t1\n")
+	f.Fuzz(func(t *testing.T, contents string) {
+		status, err := parseStatus(contents)
+		if err != nil {
+			return
+		}
+		for _, ids := range [][]int{status.NStgid, status.NSpid,
+			status.NSpgid, status.NSsid} {
+			require.True(t, ids == nil || len(ids) > 0)
+		}
+		require.True(t, status.Groups == nil || len(status.Groups) > 0)
+		if status.State != 0 {
+			require.True(t, isStateChar(status.State))
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// resource usage of a process
+type Usage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// peak resident set size in KiB
+	MaxRSSKiB   int64
+	MinorFaults int64
+	MajorFaults int64
+	// context switches
+	VoluntarySwitches   int64
+	InvoluntarySwitches int64
+}
+
+// usage as reported by wait4 or waitid
+func UsageFromRusage(rusage *unix.Rusage) Usage {
+	return Usage{
+		UserTime:            time.Duration(rusage.Utime.Nano()),
+		SystemTime:          time.Duration(rusage.Stime.Nano()),
+		MaxRSSKiB:           int64(rusage.Maxrss),
+		MinorFaults:         int64(rusage.Minflt),
+		MajorFaults:         int64(rusage.Majflt),
+		VoluntarySwitches:   int64(rusage.Nvcsw),
+		InvoluntarySwitches: int64(rusage.Nivcsw),
+	}
+}
+
+// read the usage of a live process from /proc/<pid>/stat and
+// /proc/<pid>/status.  Unlike rusage this does not include reaped children.
+// The caller must ensure that pid still refers to the intended process once
+// this returns.
+func ReadUsage(pid int) (Usage, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return Usage{}, err
+	}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		return Usage{}, err
+	}
+	return parseUsage(string(stat), string(status))
+}
+
+func parseUsage(stat string, status string) (Usage, error) {
+	parsedStat, err := parseStat(stat)
+	if err != nil {
+		return Usage{}, fmt.Errorf("read proc stat usage: %w", err)
+	}
+	// kernel threads have no VmHWM
+	parsedStatus, err := parseStatus(status)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		UserTime:            time.Duration(parsedStat.UTime) * (time.Second / CLK_TCK),
+		SystemTime:          time.Duration(parsedStat.STime) * (time.Second / CLK_TCK),
+		MaxRSSKiB:           parsedStatus.VmHWM,
+		MinorFaults:         int64(parsedStat.MinFlt),
+		MajorFaults:         int64(parsedStat.MajFlt),
+		VoluntarySwitches:   parsedStatus.VoluntaryCtxtSwitches,
+		InvoluntarySwitches: parsedStatus.NonvoluntaryCtxtSwitches,
+	}, nil
+}
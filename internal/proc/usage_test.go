@@ -0,0 +1,39 @@
+package proc
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUsage(t *testing.T) {
+	require := require.New(t)
+
+	stat := "42 (a b) S 1 42 42 0 -1 4194560 100 0 7 0 250 30 0 0 20 0 1 0 12345 1000 100"
+	status := "Name:\ta b\nVmHWM:\t    2048 kB\nvoluntary_ctxt_switches:\t5\nnonvoluntary_ctxt_switches:\t6\n"
+	usage, err := parseUsage(stat, status)
+	require.NoError(err)
+	require.Equal(Usage{
+		UserTime:            2500 * time.Millisecond,
+		SystemTime:          300 * time.Millisecond,
+		MaxRSSKiB:           2048,
+		MinorFaults:         100,
+		MajorFaults:         7,
+		VoluntarySwitches:   5,
+		InvoluntarySwitches: 6,
+	}, usage)
+
+	_, err = parseUsage(stat, "VmHWM:\tlots kB\n")
+	require.Error(err)
+}
+
+func TestReadUsage(t *testing.T) {
+	require := require.New(t)
+
+	usage, err := ReadUsage(os.Getpid())
+	require.NoError(err)
+	require.Positive(usage.MaxRSSKiB)
+	require.Positive(usage.MinorFaults)
+}
@@ -0,0 +1,213 @@
+package syscalls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// the netlink proc connector, see linux/cn_proc.h and linux/connector.h.  Not
+// in x/sys/unix.
+const (
+	cnIdxProc = 1
+	cnValProc = 1
+
+	procCnMcastListen = 1
+
+	procEventNone = 0
+
+	// sizes of struct cn_msg and of struct proc_event's header preceding its
+	// event union
+	cnMsgLen        = 20
+	procEventHdrLen = 16
+)
+
+// the proc connector did not acknowledge subscribing, as when not in the
+// initial pid namespace
+var ErrProcConnectorNoAck = errors.New("proc connector: no acknowledgement")
+
+// kinds of proc connector events, from enum what in linux/cn_proc.h
+type ProcEventKind uint32
+
+const (
+	PROC_EVENT_EXEC ProcEventKind = 0x00000002
+	PROC_EVENT_EXIT ProcEventKind = 0x80000000
+)
+
+// an exec or exit reported by the proc connector
+type ProcEvent struct {
+	Kind ProcEventKind
+	Pid  int
+	// the thread group, equal to Pid for the exit of a process rather than one
+	// of its other threads
+	Tgid int
+	// the exit status, for PROC_EVENT_EXIT
+	Status syscall.WaitStatus
+}
+
+// a netlink socket subscribed to process events from the kernel's proc
+// connector.  Unlike pidfds this reports the execs and exit statuses of
+// processes that are not our children.  Every process on the system is
+// reported, so read promptly to avoid losing events.  Requires CAP_NET_ADMIN
+// in the initial user and pid namespaces.
+type ProcConnector struct {
+	file *os.File
+	conn syscall.RawConn
+	buf  []byte
+}
+
+// subscribe to process events.  Returns an error satisfying
+// errors.Is(err, unix.EPERM) without CAP_NET_ADMIN, or ErrProcConnectorNoAck if
+// the kernel silently ignored the subscription.
+func OpenProcConnector() (*ProcConnector, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK,
+		unix.SOCK_DGRAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC,
+		unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, fmt.Errorf("proc connector socket: %w", err)
+	}
+	pc := &ProcConnector{
+		file: os.NewFile(uintptr(fd), "netlink:proc_connector"),
+		buf:  make([]byte, os.Getpagesize())}
+	pc.conn, err = pc.file.SyscallConn()
+	if err == nil {
+		err = unix.Bind(fd, &unix.SockaddrNetlink{
+			Family: unix.AF_NETLINK, Groups: cnIdxProc})
+		if err == nil {
+			err = pc.listen()
+		}
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("proc connector: %w", err), pc.Close())
+	}
+	return pc, nil
+}
+
+// how long to wait for the kernel to acknowledge subscribing
+const procConnectorAckTimeout = time.Second
+
+// send PROC_CN_MCAST_LISTEN and wait for its acknowledgement
+func (pc *ProcConnector) listen() error {
+	msg := make([]byte, unix.SizeofNlMsghdr+cnMsgLen+4)
+	binary.NativeEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.NativeEndian.PutUint16(msg[4:], unix.NLMSG_DONE)
+	binary.NativeEndian.PutUint32(msg[12:], uint32(os.Getpid()))
+	cn := msg[unix.SizeofNlMsghdr:]
+	binary.NativeEndian.PutUint32(cn[0:], cnIdxProc)
+	binary.NativeEndian.PutUint32(cn[4:], cnValProc)
+	binary.NativeEndian.PutUint16(cn[16:], 4)
+	binary.NativeEndian.PutUint32(cn[cnMsgLen:], procCnMcastListen)
+
+	var sendErr error
+	err := pc.conn.Control(func(fd uintptr) {
+		sendErr = unix.Sendto(int(fd), msg, 0,
+			&unix.SockaddrNetlink{Family: unix.AF_NETLINK})
+	})
+	if err = errors.Join(err, sendErr); err != nil {
+		return err
+	}
+
+	if err := pc.file.SetReadDeadline(
+		time.Now().Add(procConnectorAckTimeout)); err != nil {
+		return err
+	}
+	defer pc.file.SetReadDeadline(time.Time{})
+	for {
+		events, err := pc.read()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return ErrProcConnectorNoAck
+		} else if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if event.what != procEventNone {
+				continue
+			}
+			// the acknowledgement's union is its error
+			if errno := binary.NativeEndian.Uint32(event.data); errno != 0 {
+				return syscall.Errno(errno)
+			}
+			return nil
+		}
+	}
+}
+
+// a proc_event
+type procEvent struct {
+	what ProcEventKind
+	data []byte
+}
+
+// read the next datagram of events, blocking until one arrives
+func (pc *ProcConnector) read() ([]procEvent, error) {
+	var n int
+	var readErr error
+	err := pc.conn.Read(func(fd uintptr) bool {
+		n, _, readErr = unix.Recvfrom(int(fd), pc.buf, 0)
+		return readErr != unix.EAGAIN
+	})
+	if err = errors.Join(err, readErr); err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(pc.buf[:n])
+	if err != nil {
+		return nil, err
+	}
+	events := make([]procEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		if len(msg.Data) < cnMsgLen+procEventHdrLen {
+			continue
+		}
+		event := msg.Data[cnMsgLen:]
+		events = append(events, procEvent{
+			what: ProcEventKind(binary.NativeEndian.Uint32(event)),
+			data: event[procEventHdrLen:]})
+	}
+	return events, nil
+}
+
+// block until the next execs or exits are reported.  Returns an error
+// satisfying errors.Is(err, unix.ENOBUFS) if events were lost because they were
+// not read quickly enough; reading may continue.  Returns an error satisfying
+// errors.Is(err, os.ErrClosed) once closed.
+func (pc *ProcConnector) ReadEvents() ([]ProcEvent, error) {
+	for {
+		events, err := pc.read()
+		if err != nil {
+			return nil, err
+		}
+		var procEvents []ProcEvent
+		for _, event := range events {
+			// struct exec_proc_event is process_pid, process_tgid.  struct
+			// exit_proc_event begins the same followed by exit_code.
+			switch {
+			case event.what == PROC_EVENT_EXEC && len(event.data) >= 8:
+			case event.what == PROC_EVENT_EXIT && len(event.data) >= 12:
+			default:
+				continue
+			}
+			procEvent := ProcEvent{
+				Kind: event.what,
+				Pid:  int(binary.NativeEndian.Uint32(event.data[0:])),
+				Tgid: int(binary.NativeEndian.Uint32(event.data[4:]))}
+			if event.what == PROC_EVENT_EXIT {
+				procEvent.Status = syscall.WaitStatus(
+					binary.NativeEndian.Uint32(event.data[8:]))
+			}
+			procEvents = append(procEvents, procEvent)
+		}
+		if len(procEvents) > 0 {
+			return procEvents, nil
+		}
+	}
+}
+
+// close the socket, unblocking ReadEvents
+func (pc *ProcConnector) Close() error {
+	return pc.file.Close()
+}
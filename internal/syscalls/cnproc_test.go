@@ -0,0 +1,51 @@
+package syscalls
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestProcConnector(t *testing.T) {
+	require := require.New(t)
+
+	pc, err := OpenProcConnector()
+	if errors.Is(err, unix.EPERM) || errors.Is(err, ErrProcConnectorNoAck) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	defer pc.Close()
+
+	// sh execs another sh in place of itself
+	cmd := exec.Command("sh", "-c", "exec sh -c 'exit 7'")
+	require.NoError(cmd.Start())
+	pid := cmd.Process.Pid
+	defer cmd.Wait()
+
+	var kinds []ProcEventKind
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		require.True(time.Now().Before(deadline), "no exit event for %v", pid)
+		events, err := pc.ReadEvents()
+		require.NoError(err)
+		for _, event := range events {
+			if event.Pid != pid {
+				continue
+			}
+			require.Equal(pid, event.Tgid)
+			kinds = append(kinds, event.Kind)
+			if event.Kind == PROC_EVENT_EXIT {
+				require.True(event.Status.Exited())
+				require.Equal(7, event.Status.ExitStatus())
+				// sh is exec'd by exec.Command and then by itself
+				require.Equal([]ProcEventKind{
+					PROC_EVENT_EXEC, PROC_EVENT_EXEC, PROC_EVENT_EXIT}, kinds)
+				return
+			}
+		}
+	}
+}
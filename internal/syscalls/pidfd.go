@@ -5,30 +5,47 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"unsafe"
 
 	"golang.org/x/sys/unix"
 )
 
+// pidfd_open flag to open a pidfd for a single thread, which becomes readable
+// when that thread exits.  Linux 6.9+.  Not yet in x/sys/unix.
+const PIDFD_THREAD = unix.O_EXCL
+
+var (
+	// PIDFD_THREAD is not supported by this kernel
+	ErrThreadUnsupported = errors.New("pidfd_open: PIDFD_THREAD not supported by kernel")
+	// the pid is a thread id other than its thread group's leader
+	ErrNotThreadGroupLeader = errors.New("pidfd_open: pid is not a thread group leader")
+)
+
 // PidFile must be be started before blocking.
 // it must be closed after finished blocking or whenever finished using.
 type PidFile struct {
-	Pid  int
-	file *os.File
-	conn syscall.RawConn
+	Pid int
+	// Pid is a thread id, and the PidFile is done when that thread exits
+	// rather than its whole thread group
+	Thread bool
+	file   *os.File
+	conn   syscall.RawConn
 }
 
 // setup/start the process of waiting for the process.
 // PidFiles run as a 2-stop start/block so the caller immediately knows if there
 // is an error creating the file.
 // If no process is found with the provided pid the returned error will satisfy
-// errors.Is(err, unix.ESRCH)
+// errors.Is(err, unix.ESRCH).  If Thread and the kernel rejects the flag the
+// error satisfies ErrThreadUnsupported.  If not Thread and pid is a thread id
+// the error satisfies ErrNotThreadGroupLeader.
 // a PidFile must be started exactly once.
 func (pf *PidFile) Start() error {
 	if pf.file != nil {
 		panic("PidFile already started")
 	}
 
-	fd, err := unix.PidfdOpen(pf.Pid, unix.PIDFD_NONBLOCK)
+	fd, err := PidfdOpen(pf.Pid, pf.Thread, unix.PIDFD_NONBLOCK)
 	if err != nil {
 		return err
 	}
@@ -45,6 +62,22 @@ func (pf *PidFile) Start() error {
 	return nil
 }
 
+// open a pidfd for pid, or for the thread pid if thread, with additional flags.
+// Errors are as from PidFile.Start.
+func PidfdOpen(pid int, thread bool, flags int) (int, error) {
+	if thread {
+		flags |= PIDFD_THREAD
+	}
+	fd, err := unix.PidfdOpen(pid, flags)
+	if err == unix.EINVAL && thread {
+		return -1, fmt.Errorf("%w: %w", ErrThreadUnsupported, err)
+	} else if err == unix.EINVAL || err == unix.ENOENT {
+		// EINVAL before Linux 6.9, ENOENT since
+		return -1, fmt.Errorf("%w: %w", ErrNotThreadGroupLeader, err)
+	}
+	return fd, err
+}
+
 // block until the process completes. Returns any error from reading the
 // pidfile.  This does _not_ wait/reap the process, nor does it return any exit
 // code or error associated with the process's execution.
@@ -57,12 +90,120 @@ func (pf *PidFile) BlockUntilDoneOrClosed() error {
 		// "read" twice (don't ever actually read, pidfd doesn't support)
 		// the first read is not done and so it will poll.
 		// once the poll completes it will read again and we will say done
+		//
+		// the runtime poller discards readiness that arrived before this
+		// call, so first check if the process already exited.
 		callCount += 1
-		return callCount > 1
+		return callCount > 1 || IsReadable(int(fd))
 	})
 }
 
+// whether the process has completed, without blocking.  Returns an error
+// satisfying errors.Is(err, os.ErrClosed) if the PidFile is closed.
+func (pf *PidFile) Done() (bool, error) {
+	if pf.file == nil {
+		panic("PidFile not started")
+	}
+	var done bool
+	err := pf.conn.Control(func(fd uintptr) {
+		done = IsReadable(int(fd))
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", os.ErrClosed, err)
+	}
+	return done, nil
+}
+
+// check whether fd is readable, without blocking, using poll(2).  A pidfd is
+// readable once its process has completed.
+func IsReadable(fd int) bool {
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		n, err := unix.Poll(fds, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			panic(fmt.Sprintf("poll pidfd: %v", err))
+		}
+		return n > 0
+	}
+}
+
 // close the pidfile.
 func (pf *PidFile) Close() error {
 	return pf.file.Close()
 }
+
+// send a signal to the process using pidfd_send_signal.  Unlike kill this
+// cannot signal a different process that reused the pid.  Returns an error
+// satisfying errors.Is(err, unix.ESRCH) if the process has terminated, or
+// errors.Is(err, os.ErrClosed) if the PidFile was closed.
+func (pf *PidFile) SendSignal(sig unix.Signal) error {
+	if pf.file == nil {
+		panic("PidFile not started")
+	}
+	var sigErr error
+	err := pf.conn.Control(func(fd uintptr) {
+		sigErr = unix.PidfdSendSignal(int(fd), sig, nil, 0)
+	})
+	if err != nil {
+		// the only expected error is the file having been closed, which the
+		// os package does not itself report as os.ErrClosed
+		return fmt.Errorf("%w: %w", os.ErrClosed, err)
+	}
+	return sigErr
+}
+
+// si_code values of SIGCHLD siginfo_t, see sigaction(2)
+const (
+	cldExited = 1
+	cldKilled = 2
+	cldDumped = 3
+)
+
+// int32s of padding between siginfo_t's header and its union: the union is
+// pointer aligned, so there is one on 64-bit platforms and none on 32-bit.
+// sigchldInfo is laid out per architecture in siginfo*.go.
+const siginfoUnionPad = unsafe.Sizeof(uintptr(0))/4 - 1
+
+// reap the process with waitid(P_PIDFD) and return its status.  If rusage is
+// not nil it is filled with the resource usage of the process and its reaped
+// descendants.  The process must be a child of this process.  This does not
+// block: call after BlockUntilDoneOrClosed.  If the process has not yet exited
+// the returned error satisfies errors.Is(err, unix.EAGAIN).
+func (pf *PidFile) Wait(rusage *unix.Rusage) (syscall.WaitStatus, error) {
+	if pf.file == nil {
+		panic("PidFile not started")
+	}
+	var info unix.Siginfo
+	var waitErr error
+	err := pf.conn.Control(func(fd uintptr) {
+		for {
+			waitErr = unix.Waitid(unix.P_PIDFD, int(fd), &info, unix.WEXITED, rusage)
+			if waitErr != unix.EINTR {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", os.ErrClosed, err)
+	}
+	if waitErr != nil {
+		return 0, waitErr
+	}
+	return waitStatus((*sigchldInfo)(unsafe.Pointer(&info))), nil
+}
+
+// encode siginfo as a wait status, as returned by wait4
+func waitStatus(info *sigchldInfo) syscall.WaitStatus {
+	switch info.Code {
+	case cldExited:
+		return syscall.WaitStatus(info.Status << 8)
+	case cldKilled:
+		return syscall.WaitStatus(info.Status)
+	case cldDumped:
+		return syscall.WaitStatus(info.Status | 0x80)
+	}
+	panic(fmt.Sprintf("unexpected waitid si_code: %v", info.Code))
+}
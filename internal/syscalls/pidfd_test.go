@@ -1,12 +1,17 @@
 package syscalls
 
 import (
+	"errors"
+	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/stevenpelley/waitn/internal/testutil"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestPidfd(t *testing.T) {
@@ -47,6 +52,121 @@ func TestPidfd(t *testing.T) {
 	require.NoError(err)
 }
 
+// the process exits before blocking begins
+func TestPidfdAlreadyExited(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sh", "-c", "exit 0")
+	require.NoError(cmd.Start())
+	pidFile := PidFile{Pid: cmd.Process.Pid}
+	require.NoError(pidFile.Start())
+	defer pidFile.Close()
+
+	// let the process exit and the poller observe it
+	time.Sleep(100 * time.Millisecond)
+	done, err := pidFile.Done()
+	require.NoError(err)
+	require.True(done)
+	require.NoError(pidFile.BlockUntilDoneOrClosed())
+	cmd.Wait()
+}
+
+func TestPidfdDone(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	pidFile := PidFile{Pid: cmd.Process.Pid}
+	require.NoError(pidFile.Start())
+	done, err := pidFile.Done()
+	require.NoError(err)
+	require.False(done)
+
+	require.NoError(cmd.Process.Kill())
+	require.NoError(pidFile.BlockUntilDoneOrClosed())
+	done, err = pidFile.Done()
+	require.NoError(err)
+	require.True(done)
+	cmd.Wait()
+
+	require.NoError(pidFile.Close())
+	_, err = pidFile.Done()
+	require.ErrorIs(err, os.ErrClosed)
+}
+
+func TestPidfdSendSignal(t *testing.T) {
+	require := require.New(t)
+
+	cmd, procChan := createTestProcess(require)
+	pidFile := PidFile{Pid: cmd.Process.Pid}
+	err := pidFile.Start()
+	require.NoError(err)
+
+	err = pidFile.SendSignal(unix.SIGTERM)
+	require.NoError(err)
+	procResult := <-procChan
+	var exitErr *exec.ExitError
+	require.ErrorAs(procResult.err, &exitErr)
+	status := exitErr.Sys().(syscall.WaitStatus)
+	require.True(status.Signaled())
+	require.Equal(syscall.SIGTERM, status.Signal())
+
+	// reaped, so there is no process to signal
+	err = pidFile.SendSignal(unix.SIGTERM)
+	require.ErrorIs(err, unix.ESRCH)
+
+	pidFile.Close()
+	err = pidFile.SendSignal(unix.SIGTERM)
+	require.ErrorIs(err, os.ErrClosed)
+}
+
+func TestPidfdWait(t *testing.T) {
+	require := require.New(t)
+
+	// exit status
+	{
+		cmd := exec.Command("sh", "-c", "exit 3")
+		require.NoError(cmd.Start())
+		pidFile := PidFile{Pid: cmd.Process.Pid}
+		require.NoError(pidFile.Start())
+		defer pidFile.Close()
+
+		require.NoError(pidFile.BlockUntilDoneOrClosed())
+		var rusage unix.Rusage
+		status, err := pidFile.Wait(&rusage)
+		require.NoError(err)
+		require.True(status.Exited())
+		require.Equal(3, status.ExitStatus())
+		require.Positive(rusage.Maxrss)
+		cmd.Process.Release()
+	}
+
+	// killed by a signal
+	{
+		cmd := exec.Command("sleep", "10")
+		require.NoError(cmd.Start())
+		pidFile := PidFile{Pid: cmd.Process.Pid}
+		require.NoError(pidFile.Start())
+		defer pidFile.Close()
+
+		// nonblocking
+		_, err := pidFile.Wait(nil)
+		require.ErrorIs(err, unix.EAGAIN)
+
+		require.NoError(pidFile.SendSignal(unix.SIGKILL))
+		require.NoError(pidFile.BlockUntilDoneOrClosed())
+		status, err := pidFile.Wait(nil)
+		require.NoError(err)
+		require.True(status.Signaled())
+		require.Equal(syscall.SIGKILL, status.Signal())
+		cmd.Process.Release()
+
+		// already reaped
+		_, err = pidFile.Wait(nil)
+		require.ErrorIs(err, unix.ECHILD)
+	}
+}
+
 type processResult struct {
 	msg string
 	err error
@@ -74,3 +194,70 @@ func createTestProcess(require *require.Assertions) (
 	}()
 	return cmd, c
 }
+
+func TestPidfdThread(t *testing.T) {
+	require := require.New(t)
+
+	tid, release := testutil.StartThread(t)
+	pidFile := PidFile{Pid: tid, Thread: true}
+	err := pidFile.Start()
+	if errors.Is(err, ErrThreadUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	defer pidFile.Close()
+
+	// without Thread a thread id is rejected
+	{
+		pidFile := PidFile{Pid: tid}
+		err := pidFile.Start()
+		require.ErrorIs(err, ErrNotThreadGroupLeader)
+	}
+
+	done, err := pidFile.Done()
+	require.NoError(err)
+	require.False(done)
+
+	release()
+	require.NoError(pidFile.BlockUntilDoneOrClosed())
+	// this process continues
+	self := PidFile{Pid: os.Getpid()}
+	require.NoError(self.Start())
+	defer self.Close()
+	done, err = self.Done()
+	require.NoError(err)
+	require.False(done)
+}
+
+func TestPidfdForeignThread(t *testing.T) {
+	require := require.New(t)
+
+	// a thread of another process, which continues after the thread exits
+	pid, tid, release := testutil.StartForeignThread(t)
+	pidFile := PidFile{Pid: tid, Thread: true}
+	err := pidFile.Start()
+	if errors.Is(err, ErrThreadUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	defer pidFile.Close()
+
+	{
+		pidFile := PidFile{Pid: tid}
+		err := pidFile.Start()
+		require.ErrorIs(err, ErrNotThreadGroupLeader)
+	}
+
+	done, err := pidFile.Done()
+	require.NoError(err)
+	require.False(done)
+
+	release()
+	require.NoError(pidFile.BlockUntilDoneOrClosed())
+	helper := PidFile{Pid: pid}
+	require.NoError(helper.Start())
+	defer helper.Close()
+	done, err = helper.Done()
+	require.NoError(err)
+	require.False(done)
+}
@@ -0,0 +1,25 @@
+package syscalls
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// raise the soft limit on open files to the hard limit and return the new soft
+// limit.  Since Go 1.19 the runtime raises it at startup to one less than the
+// hard limit, restoring the original soft limit in processes this one starts,
+// which may use select(2).  That is left alone, as setting the limit stops the
+// runtime from restoring it, so this only raises the limit if it was lowered
+// since.  Processes this one starts then inherit the raised limit.
+func RaiseFileLimit() (uint64, error) {
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	if lim.Max > 0 && lim.Cur < lim.Max-1 {
+		lim.Cur = lim.Max
+		if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &lim); err != nil {
+			return 0, err
+		}
+	}
+	return lim.Cur, nil
+}
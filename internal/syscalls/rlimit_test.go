@@ -0,0 +1,28 @@
+package syscalls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestRaiseFileLimit(t *testing.T) {
+	require := require.New(t)
+
+	var orig unix.Rlimit
+	require.NoError(unix.Getrlimit(unix.RLIMIT_NOFILE, &orig))
+	defer unix.Setrlimit(unix.RLIMIT_NOFILE, &orig)
+	if orig.Max < 2 {
+		t.Skip("hard limit on open files too low")
+	}
+
+	lowered := unix.Rlimit{Cur: orig.Max / 2, Max: orig.Max}
+	require.NoError(unix.Setrlimit(unix.RLIMIT_NOFILE, &lowered))
+	limit, err := RaiseFileLimit()
+	require.NoError(err)
+	require.Equal(orig.Max, limit)
+	var raised unix.Rlimit
+	require.NoError(unix.Getrlimit(unix.RLIMIT_NOFILE, &raised))
+	require.Equal(orig.Max, raised.Cur)
+}
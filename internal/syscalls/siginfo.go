@@ -0,0 +1,14 @@
+//go:build !mips && !mipsle && !mips64 && !mips64le
+
+package syscalls
+
+// siginfo_t as filled in for SIGCHLD by waitid.  Overlays unix.Siginfo.
+type sigchldInfo struct {
+	Signo  int32
+	Errno  int32
+	Code   int32
+	_      [siginfoUnionPad]int32
+	Pid    int32
+	Uid    uint32
+	Status int32
+}
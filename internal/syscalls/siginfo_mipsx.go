@@ -0,0 +1,15 @@
+//go:build mips || mipsle || mips64 || mips64le
+
+package syscalls
+
+// siginfo_t as filled in for SIGCHLD by waitid.  Overlays unix.Siginfo.  mips
+// swaps si_code and si_errno.
+type sigchldInfo struct {
+	Signo  int32
+	Code   int32
+	Errno  int32
+	_      [siginfoUnionPad]int32
+	Pid    int32
+	Uid    uint32
+	Status int32
+}
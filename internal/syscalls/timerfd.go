@@ -0,0 +1,71 @@
+package syscalls
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// a one-shot timer on a clock such as CLOCK_BOOTTIME, which unlike Go's timers
+// keeps counting while the system is suspended.  It is waited for with the
+// runtime poller, alongside pidfds.  It must be closed once finished using.
+type Timerfd struct {
+	file *os.File
+	conn syscall.RawConn
+}
+
+// arm a timer on clock expiring once d has elapsed.  d of zero or less expires
+// immediately.
+func NewTimerfd(clock int, d time.Duration) (*Timerfd, error) {
+	return newTimerfd(clock, 0, d)
+}
+
+// arm a timer on clock expiring once the clock reaches at, measured from the
+// clock's epoch.  Times already reached expire immediately.  Unlike NewTimerfd
+// the expiry follows changes to the clock, as when CLOCK_REALTIME is set.
+func NewTimerfdAt(clock int, at time.Duration) (*Timerfd, error) {
+	return newTimerfd(clock, unix.TFD_TIMER_ABSTIME, at)
+}
+
+func newTimerfd(clock int, flags int, value time.Duration) (*Timerfd, error) {
+	fd, err := unix.TimerfdCreate(clock, unix.TFD_NONBLOCK|unix.TFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("timerfd_create: %w", err)
+	}
+	// a zero value disarms the timer
+	spec := unix.ItimerSpec{Value: unix.NsecToTimespec(max(value.Nanoseconds(), 1))}
+	if err := unix.TimerfdSettime(fd, flags, &spec, nil); err != nil {
+		return nil, errors.Join(fmt.Errorf("timerfd_settime: %w", err),
+			unix.Close(fd))
+	}
+	t := &Timerfd{file: os.NewFile(uintptr(fd), "timerfd")}
+	t.conn, err = t.file.SyscallConn()
+	if err != nil {
+		return nil, errors.Join(err, t.file.Close())
+	}
+	return t, nil
+}
+
+// block until the timer expires or the timerfd is closed.  Returns an error
+// satisfying errors.Is(err, os.ErrClosed) if closed first.
+func (t *Timerfd) Wait() error {
+	var readErr error
+	err := t.conn.Read(func(fd uintptr) bool {
+		// the number of expirations, which we don't need
+		var buf [8]byte
+		_, readErr = unix.Read(int(fd), buf[:])
+		return readErr != unix.EAGAIN
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", os.ErrClosed, err)
+	}
+	return readErr
+}
+
+func (t *Timerfd) Close() error {
+	return t.file.Close()
+}
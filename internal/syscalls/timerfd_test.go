@@ -0,0 +1,58 @@
+package syscalls
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTimerfd(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now()
+	timer, err := NewTimerfd(unix.CLOCK_BOOTTIME, 50*time.Millisecond)
+	require.NoError(err)
+	require.NoError(timer.Wait())
+	require.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	require.NoError(timer.Close())
+
+	// expired timers need no waiting
+	timer, err = NewTimerfd(unix.CLOCK_BOOTTIME, 0)
+	require.NoError(err)
+	require.NoError(timer.Wait())
+	require.NoError(timer.Close())
+
+	// closing unblocks waiting
+	timer, err = NewTimerfd(unix.CLOCK_BOOTTIME, time.Hour)
+	require.NoError(err)
+	errs := make(chan error)
+	go func() { errs <- timer.Wait() }()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(timer.Close())
+	require.ErrorIs(<-errs, os.ErrClosed)
+}
+
+func TestTimerfdAt(t *testing.T) {
+	require := require.New(t)
+
+	for _, clock := range []int32{unix.CLOCK_REALTIME, unix.CLOCK_BOOTTIME} {
+		var now unix.Timespec
+		require.NoError(unix.ClockGettime(clock, &now))
+		start := time.Now()
+		timer, err := NewTimerfdAt(int(clock),
+			time.Duration(now.Nano())+50*time.Millisecond)
+		require.NoError(err)
+		require.NoError(timer.Wait())
+		require.GreaterOrEqual(time.Since(start), 40*time.Millisecond)
+		require.NoError(timer.Close())
+
+		// times already reached need no waiting
+		timer, err = NewTimerfdAt(int(clock), time.Duration(now.Nano()))
+		require.NoError(err)
+		require.NoError(timer.Wait())
+		require.NoError(timer.Close())
+	}
+}
@@ -0,0 +1,262 @@
+package syscalls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring, see linux/io_uring.h.  Not in x/sys/unix.
+const (
+	ioringOpNop        = 0
+	ioringOpPollAdd    = 6
+	ioringOpPollRemove = 7
+
+	ioringEnterGetevents = 1 << 0
+
+	// completions are never dropped when the completion queue is full.  Linux
+	// 5.5+.
+	ioringFeatNodrop = 1 << 1
+
+	ioringOffSqRing = 0
+	ioringOffCqRing = 0x8000000
+	ioringOffSqes   = 0x10000000
+
+	sqeLen = 64
+	cqeLen = 16
+)
+
+// io_uring cannot be used, as before Linux 5.5, when disabled by the
+// kernel.io_uring_disabled sysctl, or under seccomp profiles that block it
+var ErrUringUnsupported = errors.New("io_uring: not supported")
+
+// struct io_sqring_offsets
+type sqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Flags       uint32
+	Dropped     uint32
+	Array       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+// struct io_cqring_offsets
+type cqringOffsets struct {
+	Head        uint32
+	Tail        uint32
+	RingMask    uint32
+	RingEntries uint32
+	Overflow    uint32
+	Cqes        uint32
+	Flags       uint32
+	Resv1       uint32
+	UserAddr    uint64
+}
+
+// struct io_uring_params
+type uringParams struct {
+	SqEntries    uint32
+	CqEntries    uint32
+	Flags        uint32
+	SqThreadCPU  uint32
+	SqThreadIdle uint32
+	Features     uint32
+	WqFd         uint32
+	Resv         [3]uint32
+	SqOff        sqringOffsets
+	CqOff        cqringOffsets
+}
+
+// a completion of a submitted operation
+type UringCompletion struct {
+	UserData uint64
+	// the operation's result, a negated errno on failure
+	Res int32
+}
+
+// an io_uring used to poll many file descriptors, such as pidfds, without
+// registering each with epoll.  Operations are queued and submitted in batches
+// by Submit, or once the submission queue is full.  Any number of goroutines
+// may queue operations but only one may wait for completions at a time.
+type Uring struct {
+	fd      int
+	sqRing  []byte
+	cqRing  []byte
+	sqes    []byte
+	params  uringParams
+	sqMu    sync.Mutex
+	sqTail  uint32
+	pending uint32
+}
+
+// create an io_uring with a submission queue of entries.  Returns an error
+// satisfying ErrUringUnsupported if io_uring may not be used.
+func OpenUring(entries uint32) (*Uring, error) {
+	r := &Uring{}
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP,
+		uintptr(entries), uintptr(unsafe.Pointer(&r.params)), 0)
+	if errno == unix.ENOSYS || errno == unix.EPERM {
+		return nil, fmt.Errorf("%w: %w", ErrUringUnsupported, errno)
+	} else if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+	r.fd = int(fd)
+	if r.params.Features&ioringFeatNodrop == 0 {
+		return nil, errors.Join(
+			fmt.Errorf("%w: completions may be dropped", ErrUringUnsupported),
+			r.Close())
+	}
+
+	var err error
+	r.sqRing, err = unix.Mmap(r.fd, ioringOffSqRing,
+		int(r.params.SqOff.Array+r.params.SqEntries*4),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err == nil {
+		r.cqRing, err = unix.Mmap(r.fd, ioringOffCqRing,
+			int(r.params.CqOff.Cqes+r.params.CqEntries*cqeLen),
+			unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	}
+	if err == nil {
+		r.sqes, err = unix.Mmap(r.fd, ioringOffSqes,
+			int(r.params.SqEntries*sqeLen),
+			unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	}
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("io_uring mmap: %w", err), r.Close())
+	}
+	r.sqTail = *r.u32(r.sqRing, r.params.SqOff.Tail)
+	return r, nil
+}
+
+// the uint32 at offset off of a ring, shared with the kernel
+func (r *Uring) u32(ring []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[off]))
+}
+
+// queue an operation, submitting those queued first if the queue is full
+func (r *Uring) queue(opcode uint8, fd int32, addr uint64, opFlags uint32,
+	userData uint64) error {
+	r.sqMu.Lock()
+	defer r.sqMu.Unlock()
+	if r.sqTail-atomic.LoadUint32(r.u32(r.sqRing, r.params.SqOff.Head)) ==
+		r.params.SqEntries {
+		if err := r.submitLocked(); err != nil {
+			return err
+		}
+	}
+	idx := r.sqTail & *r.u32(r.sqRing, r.params.SqOff.RingMask)
+	sqe := r.sqes[idx*sqeLen : (idx+1)*sqeLen]
+	clear(sqe)
+	sqe[0] = opcode
+	binary.NativeEndian.PutUint32(sqe[4:], uint32(fd))
+	binary.NativeEndian.PutUint64(sqe[16:], addr)
+	binary.NativeEndian.PutUint32(sqe[28:], opFlags)
+	binary.NativeEndian.PutUint64(sqe[32:], userData)
+	*r.u32(r.sqRing, r.params.SqOff.Array+idx*4) = idx
+	r.sqTail++
+	atomic.StoreUint32(r.u32(r.sqRing, r.params.SqOff.Tail), r.sqTail)
+	r.pending++
+	return nil
+}
+
+// queue a one-shot poll for fd becoming readable, completing with userData
+func (r *Uring) PollAdd(fd int, userData uint64) error {
+	return r.queue(ioringOpPollAdd, int32(fd), 0, pollEvents(unix.POLLIN), userData)
+}
+
+// queue cancelling the poll queued with target, completing with userData.  The
+// cancelled poll completes with -ECANCELED.
+func (r *Uring) PollRemove(target uint64, userData uint64) error {
+	return r.queue(ioringOpPollRemove, -1, target, 0, userData)
+}
+
+// queue an operation that completes immediately with userData, as to wake a
+// goroutine waiting for completions
+func (r *Uring) Nop(userData uint64) error {
+	return r.queue(ioringOpNop, -1, 0, 0, userData)
+}
+
+// poll events as the kernel reads them from a submission, whose halves are
+// swapped on big-endian platforms
+func pollEvents(events uint32) uint32 {
+	if binary.NativeEndian.Uint16([]byte{0, 1}) == 1 {
+		return events<<16 | events>>16
+	}
+	return events
+}
+
+// submit all queued operations
+func (r *Uring) Submit() error {
+	r.sqMu.Lock()
+	defer r.sqMu.Unlock()
+	return r.submitLocked()
+}
+
+func (r *Uring) submitLocked() error {
+	for r.pending > 0 {
+		n, err := r.enter(r.pending, 0, 0)
+		if err != nil {
+			return err
+		}
+		r.pending -= n
+	}
+	return nil
+}
+
+func (r *Uring) enter(toSubmit uint32, minComplete uint32, flags uint32) (
+	uint32, error) {
+	for {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd),
+			uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return 0, fmt.Errorf("io_uring_enter: %w", errno)
+		}
+		return uint32(n), nil
+	}
+}
+
+// block until at least one operation completes and return every completion
+// available.  Operations must be submitted first.
+func (r *Uring) WaitCompletions() ([]UringCompletion, error) {
+	head := r.u32(r.cqRing, r.params.CqOff.Head)
+	tail := r.u32(r.cqRing, r.params.CqOff.Tail)
+	if *head == atomic.LoadUint32(tail) {
+		if _, err := r.enter(0, 1, ioringEnterGetevents); err != nil {
+			return nil, err
+		}
+	}
+	mask := *r.u32(r.cqRing, r.params.CqOff.RingMask)
+	var completions []UringCompletion
+	for h := *head; h != atomic.LoadUint32(tail); h++ {
+		off := r.params.CqOff.Cqes + (h&mask)*cqeLen
+		completions = append(completions, UringCompletion{
+			UserData: binary.NativeEndian.Uint64(r.cqRing[off:]),
+			Res:      int32(binary.NativeEndian.Uint32(r.cqRing[off+8:]))})
+		atomic.StoreUint32(head, h+1)
+	}
+	return completions, nil
+}
+
+// unmap and close the ring, cancelling all operations.  No goroutine may be
+// waiting for completions.
+func (r *Uring) Close() error {
+	var errs []error
+	for _, ring := range [][]byte{r.sqes, r.cqRing, r.sqRing} {
+		if ring != nil {
+			errs = append(errs, unix.Munmap(ring))
+		}
+	}
+	errs = append(errs, unix.Close(r.fd))
+	return errors.Join(errs...)
+}
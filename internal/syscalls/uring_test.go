@@ -0,0 +1,65 @@
+package syscalls
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestUring(t *testing.T) {
+	require := require.New(t)
+
+	ring, err := OpenUring(4)
+	if errors.Is(err, ErrUringUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	defer ring.Close()
+
+	var fds [2]int
+	require.NoError(unix.Pipe2(fds[:], unix.O_CLOEXEC))
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	// more operations than the submission queue holds are submitted in
+	// batches
+	for i := uint64(1); i <= 5; i++ {
+		require.NoError(ring.Nop(i))
+	}
+	require.NoError(ring.PollAdd(fds[0], 6))
+	require.NoError(ring.Submit())
+	var userData []uint64
+	for len(userData) < 5 {
+		completions, err := ring.WaitCompletions()
+		require.NoError(err)
+		for _, completion := range completions {
+			userData = append(userData, completion.UserData)
+		}
+	}
+	require.Equal([]uint64{1, 2, 3, 4, 5}, userData)
+
+	// the poll completes once the pipe is readable
+	_, err = unix.Write(fds[1], []byte{0})
+	require.NoError(err)
+	completions, err := ring.WaitCompletions()
+	require.NoError(err)
+	require.Len(completions, 1)
+	require.Equal(uint64(6), completions[0].UserData)
+	require.Equal(int32(unix.POLLIN), completions[0].Res&unix.POLLIN)
+
+	// a removed poll is cancelled
+	require.NoError(ring.PollAdd(fds[1], 7))
+	require.NoError(ring.PollRemove(7, 8))
+	require.NoError(ring.Submit())
+	res := map[uint64]int32{}
+	for len(res) < 2 {
+		completions, err := ring.WaitCompletions()
+		require.NoError(err)
+		for _, completion := range completions {
+			res[completion.UserData] = completion.Res
+		}
+	}
+	require.Equal(map[uint64]int32{7: -int32(unix.ECANCELED), 8: 0}, res)
+}
@@ -0,0 +1,107 @@
+// Package testutil holds test fixtures shared by several packages.
+package testutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// set in the environment of a test binary re-executed by StartForeignThread
+const threadHelperEnv = "WAITN_TESTUTIL_THREAD_HELPER"
+
+// start an OS thread of this process, other than the main thread, returning
+// its thread id and a function that makes it exit.  The function may be called
+// more than once and is called when the test ends.
+func StartThread(t testing.TB) (int, func()) {
+	tid, release := startThread()
+	t.Cleanup(release)
+	return tid, release
+}
+
+func startThread() (int, func()) {
+	for {
+		tids := make(chan int)
+		release := make(chan struct{})
+		go func() {
+			// a goroutine exiting while locked terminates its thread, unless
+			// it is the main thread.  Then try again on another.
+			runtime.LockOSThread()
+			tid := unix.Gettid()
+			tids <- tid
+			if tid == os.Getpid() {
+				runtime.UnlockOSThread()
+				return
+			}
+			<-release
+		}()
+		if tid := <-tids; tid != os.Getpid() {
+			return tid, sync.OnceFunc(func() { close(release) })
+		}
+	}
+}
+
+// start a helper process, a child of this one, with an OS thread other than its
+// main thread.  Returns the helper's pid, the thread's id, and a function that
+// makes the thread exit while the helper continues.  The function may be called
+// more than once.  The helper exits when the test ends.
+func StartForeignThread(t testing.TB) (int, int, func()) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), threadHelperEnv+"=1")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("thread helper: %v", err)
+	}
+	tid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("thread helper: %v", err)
+	}
+	release := sync.OnceFunc(func() {
+		if _, err := io.WriteString(stdin, "\n"); err != nil {
+			t.Errorf("thread helper: %v", err)
+		}
+	})
+	return cmd.Process.Pid, tid, release
+}
+
+// as the helper process of StartForeignThread: print the thread id, make the
+// thread exit on the first line of stdin, and exit on its end.
+func init() {
+	if os.Getenv(threadHelperEnv) == "" {
+		return
+	}
+	tid, release := startThread()
+	fmt.Println(tid)
+	stdin := bufio.NewReader(os.Stdin)
+	if _, err := stdin.ReadString('\n'); err == nil {
+		release()
+		io.Copy(io.Discard, stdin)
+	}
+	os.Exit(0)
+}
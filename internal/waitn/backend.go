@@ -0,0 +1,115 @@
+package waitn
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// opens pid files to wait for processes.  AutoBackend is the default; tests
+// may script exits and errors with a fake instead of running processes.
+type Backend interface {
+	// open a pid file for the process pid or, if thread, the thread pid.
+	// Errors are as from syscalls.PidFile.Start: unix.ESRCH if no process is
+	// found, ErrThreadUnsupported, or ErrNotThreadGroupLeader.  Backends that
+	// cannot tell whether a process they may not see exists return
+	// ErrInvisible.
+	Open(pid int, thread bool) (PidFile, error)
+}
+
+// an open handle on a process, or thread, that may be waited for.  It must be
+// closed after finished blocking or whenever finished using.  Methods are as
+// those of syscalls.PidFile.
+type PidFile interface {
+	// the pid the pid file was opened for
+	Pid() int
+	// block until the process completes or the pid file is closed
+	BlockUntilDoneOrClosed() error
+	// whether the process has completed, without blocking.  Returns an error
+	// satisfying errors.Is(err, os.ErrClosed) if the pid file is closed.
+	Done() (bool, error)
+	// send a signal to the process.  Returns an error satisfying
+	// errors.Is(err, unix.ESRCH) if it has terminated, or
+	// errors.Is(err, os.ErrClosed) if the pid file is closed.
+	SendSignal(sig unix.Signal) error
+	Close() error
+}
+
+// the backend using pidfds
+var PidfdBackend Backend = pidfdBackend{}
+
+type pidfdBackend struct{}
+
+func (pidfdBackend) Open(pid int, thread bool) (PidFile, error) {
+	pidFile := &syscalls.PidFile{Pid: pid, Thread: thread}
+	if err := pidFile.Start(); err != nil {
+		return nil, err
+	}
+	return pidfd{pidFile}, nil
+}
+
+// a started syscalls.PidFile, such as that of a Launched process
+type pidfd struct {
+	*syscalls.PidFile
+}
+
+func (pf pidfd) Pid() int {
+	return pf.PidFile.Pid
+}
+
+// the backend using pidfds until pidfd_open fails with ENOSYS, as before
+// Linux 5.3, or EPERM, as under seccomp profiles that block it, and then
+// polling with PollBackend.  Pidfds are kept open for a window of pids within
+// the limit on open files, raised to its hard limit, and pids beyond it are
+// polled until rotated into the window.
+var AutoBackend Backend = &autoBackend{
+	pidfd: newWindowBackend(PidfdBackend, PollBackend, fileLimitWindow),
+	poll:  PollBackend}
+
+type autoBackend struct {
+	pidfd   Backend
+	poll    Backend
+	polling atomic.Bool
+}
+
+func (b *autoBackend) Open(pid int, thread bool) (PidFile, error) {
+	if !b.polling.Load() {
+		pidFile, err := b.pidfd.Open(pid, thread)
+		if !errors.Is(err, unix.ENOSYS) && !errors.Is(err, unix.EPERM) {
+			return pidFile, err
+		}
+		b.polling.Store(true)
+	}
+	return b.poll.Open(pid, thread)
+}
+
+// parse a backend name: auto, pidfd, poll, or uring.  Returns an *ExitError if it is
+// not a backend.
+func ParseBackend(s string) (Backend, error) {
+	switch s {
+	case "auto":
+		return AutoBackend, nil
+	case "pidfd":
+		return PidfdBackend, nil
+	case "poll":
+		return PollBackend, nil
+	case "uring":
+		backend, err := NewUringBackend()
+		if err != nil {
+			return nil, &ExitError{
+				Message:      "io_uring backend",
+				ExitCode:     INPUT_ERROR,
+				DisplayUsage: false,
+				Cause:        err}
+		}
+		return backend, nil
+	}
+	return nil, &ExitError{
+		Message:      fmt.Sprintf("unknown backend: %v", s),
+		ExitCode:     INPUT_ERROR,
+		DisplayUsage: true,
+		Cause:        nil}
+}
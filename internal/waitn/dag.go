@@ -0,0 +1,270 @@
+package waitn
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+)
+
+// a task of a dependency graph run by RunDAG
+type Task struct {
+	Name    string
+	Command string
+	// names of tasks that must succeed before this task starts
+	Deps []string
+}
+
+type TaskStatus string
+
+const (
+	TASK_SUCCEEDED TaskStatus = "succeeded"
+	TASK_FAILED    TaskStatus = "failed"
+	// not started because a dependency did not succeed, or because the run
+	// was halted
+	TASK_SKIPPED TaskStatus = "skipped"
+)
+
+// the result of a task.  Pid, ExitCode, times, and Usage are zero for skipped
+// tasks.
+type TaskResult struct {
+	Name     string
+	Status   TaskStatus
+	Pid      int
+	ExitCode int
+	Start    time.Time
+	End      time.Time
+	Usage    proc.Usage
+}
+
+// parse a task spec.  Each line is
+//
+//	<name> [<dep>...] : <command>
+//
+// The command is everything after the first colon and is run with sh -c.
+// Empty lines and lines starting with # are ignored.  Returns an error if any
+// line is malformed, names are repeated, dependencies are unknown, or
+// dependencies form a cycle.
+func ParseDAG(r io.Reader) ([]Task, error) {
+	var tasks []Task
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		before, command, found := strings.Cut(line, ":")
+		names := strings.Fields(before)
+		command = strings.TrimSpace(command)
+		if !found || len(names) == 0 || command == "" {
+			return nil, fmt.Errorf(
+				"line %v: expected <name> [<dep>...] : <command>", lineNum)
+		}
+		tasks = append(tasks, Task{Name: names[0], Command: command, Deps: names[1:]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateDAG(tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func validateDAG(tasks []Task) error {
+	byName := make(map[string]*Task, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		if _, ok := byName[task.Name]; ok {
+			return fmt.Errorf("task %v: repeated", task.Name)
+		}
+		byName[task.Name] = task
+	}
+	for _, task := range tasks {
+		for _, dep := range task.Deps {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("task %v: unknown dependency %v", task.Name, dep)
+			}
+		}
+	}
+
+	// depth first search for cycles
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(tasks))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("task %v: dependency cycle", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range byName[name].Deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, task := range tasks {
+		if err := visit(task.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run tasks with sh -c, each in its own process group and starting once all of
+// its dependencies succeed.  Tasks have stdin from /dev/null and this process's
+// stdout and stderr.  Tasks whose dependencies fail are skipped.  If failFast
+// then once any task fails no further tasks start and running tasks' process
+// groups are sent SIGTERM, then SIGKILL after grace.  The same happens when the
+// context ends.  Each time tasks are running WaitForPidFile waits for the
+// first to finish, using pid files opened by backend, and its successors are
+// scheduled once it is reaped.
+//
+// Returns a result for every task, in the order of tasks, and, if the context
+// ended, an error as WaitForPidFile does.
+func RunDAG(ctx context.Context, backend Backend, tasks []Task, failFast bool,
+	grace time.Duration) ([]TaskResult, error) {
+	results := make([]TaskResult, len(tasks))
+	index := make(map[string]int, len(tasks))
+	for i, task := range tasks {
+		index[task.Name] = i
+		results[i].Name = task.Name
+	}
+	// tasks by pid
+	running := make(map[int]*Launched)
+	runningTask := make(map[int]int)
+
+	halting := false
+	var exErr error
+	for {
+		// start ready tasks and skip those that can never be ready.  Skipping
+		// may make other tasks skippable, so repeat until nothing changes.
+		for changed := true; changed; {
+			changed = false
+			for i, task := range tasks {
+				if results[i].Status != "" || !results[i].Start.IsZero() {
+					continue
+				}
+				ready := true
+				for _, dep := range task.Deps {
+					switch results[index[dep]].Status {
+					case TASK_SUCCEEDED:
+					case "":
+						ready = false
+					default:
+						results[i].Status = TASK_SKIPPED
+					}
+				}
+				if results[i].Status == TASK_SKIPPED || halting {
+					results[i].Status = TASK_SKIPPED
+					changed = true
+					continue
+				}
+				if !ready {
+					continue
+				}
+				results[i].Start = time.Now()
+				launched, err := startTask(task)
+				if err != nil {
+					finishTask(&results[i], INPUT_ERROR)
+					halting = halting || failFast
+					changed = true
+					continue
+				}
+				results[i].Pid = launched.PidFile.Pid
+				running[launched.PidFile.Pid] = launched
+				runningTask[launched.PidFile.Pid] = i
+			}
+		}
+		if len(running) == 0 {
+			break
+		}
+
+		// running tasks are children and so are not reaped until we wait for
+		// them
+		pidFiles := make([]PidFile, 0, len(running))
+		for i := range tasks {
+			// a finished task's pid may have been reused by a running task
+			if j, ok := runningTask[results[i].Pid]; !ok || j != i {
+				continue
+			}
+			pidFile, err := backend.Open(results[i].Pid, false)
+			if err != nil {
+				panic(err)
+			}
+			pidFiles = append(pidFiles, pidFile)
+		}
+		finished, err := WaitForPidFile(ctx, pidFiles)
+		if err != nil {
+			exErr = err
+			halting = true
+			terminateTasks(running, runningTask, results, grace)
+			continue
+		}
+
+		pid := int(finished.Pid)
+		i := runningTask[pid]
+		finishTask(&results[i], running[pid].Wait())
+		results[i].Usage = running[pid].Usage
+		delete(running, pid)
+		delete(runningTask, pid)
+		if results[i].Status == TASK_FAILED && failFast && !halting {
+			halting = true
+			terminateTasks(running, runningTask, results, grace)
+		}
+	}
+	return results, exErr
+}
+
+func startTask(task Task) (*Launched, error) {
+	return LaunchCmd(shellCommand(task.Command))
+}
+
+func finishTask(result *TaskResult, exitCode int) {
+	result.End = time.Now()
+	result.ExitCode = exitCode
+	result.Status = TASK_SUCCEEDED
+	if exitCode != 0 {
+		result.Status = TASK_FAILED
+	}
+}
+
+// terminate all running tasks concurrently, recording their results.
+func terminateTasks(running map[int]*Launched, runningTask map[int]int,
+	results []TaskResult, grace time.Duration) {
+	type terminated struct {
+		pid      int
+		exitCode int
+	}
+	c := make(chan terminated, len(running))
+	for pid, launched := range running {
+		pid, launched := pid, launched
+		go func() {
+			c <- terminated{pid: pid, exitCode: launched.Terminate(syscall.SIGTERM, grace)}
+		}()
+	}
+	for range running {
+		t := <-c
+		result := &results[runningTask[t.pid]]
+		finishTask(result, t.exitCode)
+		result.Usage = running[t.pid].Usage
+	}
+	for pid := range running {
+		delete(running, pid)
+		delete(runningTask, pid)
+	}
+}
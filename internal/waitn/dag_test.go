@@ -0,0 +1,199 @@
+package waitn
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDAG(t *testing.T) {
+	require := require.New(t)
+
+	tasks, err := ParseDAG(strings.NewReader(`
+# comment
+a: echo a: done
+b a : echo b
+c a b: exit 1
+`))
+	require.NoError(err)
+	require.Equal([]Task{
+		{Name: "a", Command: "echo a: done", Deps: []string{}},
+		{Name: "b", Command: "echo b", Deps: []string{"a"}},
+		{Name: "c", Command: "exit 1", Deps: []string{"a", "b"}},
+	}, tasks)
+
+	for spec, msg := range map[string]string{
+		"a echo a":              "line 1",
+		": echo a":              "line 1",
+		"a:":                    "line 1",
+		"a: true\na: true":      "repeated",
+		"a b: true":             "unknown dependency b",
+		"a b: true\nb a: true":  "cycle",
+		"a a: true":             "cycle",
+		"a: true\n\nb c: true":  "unknown dependency c",
+		"a: true\nb a c: false": "unknown dependency c",
+	} {
+		_, err := ParseDAG(strings.NewReader(spec))
+		require.ErrorContains(err, msg, spec)
+	}
+}
+
+// each task's status by name
+func statuses(results []TaskResult) map[string]TaskStatus {
+	m := make(map[string]TaskStatus)
+	for _, result := range results {
+		m[result.Name] = result.Status
+	}
+	return m
+}
+
+func TestRunDAG(t *testing.T) {
+	require := require.New(t)
+
+	// continue: independent tasks run after a failure, dependents are skipped
+	{
+		tasks, err := ParseDAG(strings.NewReader(`
+a: sleep 0.1
+b a: exit 2
+c a: sleep 0.2
+d b: true
+e c: true
+`))
+		require.NoError(err)
+		results, err := RunDAG(context.Background(), PidfdBackend, tasks, false, time.Second)
+		require.NoError(err)
+		require.Equal(map[string]TaskStatus{
+			"a": TASK_SUCCEEDED,
+			"b": TASK_FAILED,
+			"c": TASK_SUCCEEDED,
+			"d": TASK_SKIPPED,
+			"e": TASK_SUCCEEDED,
+		}, statuses(results))
+		require.Equal(2, results[1].ExitCode)
+		// successors start after their dependencies end
+		require.False(results[2].Start.Before(results[0].End))
+		require.False(results[4].Start.Before(results[2].End))
+	}
+
+	// fail fast: running tasks are terminated, pending tasks skipped
+	{
+		tasks, err := ParseDAG(strings.NewReader(`
+a: exit 1
+b: exec sleep 10
+c b: true
+`))
+		require.NoError(err)
+		results, err := RunDAG(context.Background(), PidfdBackend, tasks, true, time.Second)
+		require.NoError(err)
+		require.Equal(map[string]TaskStatus{
+			"a": TASK_FAILED,
+			"b": TASK_FAILED,
+			"c": TASK_SKIPPED,
+		}, statuses(results))
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), results[1].ExitCode)
+	}
+
+	// terminating a task terminates processes started by its shell
+	{
+		command, grandchild := grandchildCommand(t)
+		tasks, err := ParseDAG(strings.NewReader(`
+a: sleep 0.1; exit 1
+b: ` + command + `
+`))
+		require.NoError(err)
+		results, err := RunDAG(context.Background(), PidfdBackend, tasks, true, time.Second)
+		require.NoError(err)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), results[1].ExitCode)
+		requireExits(t, grandchild())
+	}
+
+	// running tasks are waited for with pid files from the backend, all closed
+	// by the time the run finishes
+	for _, backend := range []Backend{PidfdBackend, PollBackend} {
+		counting := &countingBackend{backend: backend}
+		tasks, err := ParseDAG(strings.NewReader(`
+a: sleep 0.1
+b a: sleep 0.1
+c: sleep 0.3
+d: true
+`))
+		require.NoError(err)
+		results, err := RunDAG(context.Background(), counting, tasks, false, time.Second)
+		require.NoError(err)
+		for _, result := range results {
+			require.Equal(TASK_SUCCEEDED, result.Status)
+		}
+		require.GreaterOrEqual(counting.opened, 4)
+		require.Equal(counting.opened, counting.closed)
+	}
+
+	// timeout
+	{
+		tasks, err := ParseDAG(strings.NewReader(`
+a: exec sleep 10
+b a: true
+`))
+		require.NoError(err)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		results, err := RunDAG(ctx, PidfdBackend, tasks, false, time.Second)
+		require.ErrorIs(err, TimeoutErr)
+		require.Equal(map[string]TaskStatus{
+			"a": TASK_FAILED,
+			"b": TASK_SKIPPED,
+		}, statuses(results))
+	}
+}
+
+// the io_uring backend waits for all running tasks at once
+func TestRunDAGUring(t *testing.T) {
+	require := require.New(t)
+	backend := newTestUringBackend(t)
+	defer func() { require.NoError(backend.Close()) }()
+
+	tasks, err := ParseDAG(strings.NewReader(`
+a: sleep 0.1
+b a: exit 1
+c: sleep 0.2
+d b: true
+`))
+	require.NoError(err)
+	results, err := RunDAG(context.Background(), backend, tasks, false, time.Second)
+	require.NoError(err)
+	require.Equal(map[string]TaskStatus{
+		"a": TASK_SUCCEEDED,
+		"b": TASK_FAILED,
+		"c": TASK_SUCCEEDED,
+		"d": TASK_SKIPPED,
+	}, statuses(results))
+}
+
+// counts the pid files opened and closed through backend
+type countingBackend struct {
+	backend Backend
+	opened  int
+	closed  int
+}
+
+func (b *countingBackend) Open(pid int, thread bool) (PidFile, error) {
+	pidFile, err := b.backend.Open(pid, thread)
+	if err != nil {
+		return nil, err
+	}
+	b.opened++
+	return countingPidFile{PidFile: pidFile, backend: b}, nil
+}
+
+type countingPidFile struct {
+	PidFile
+	backend *countingBackend
+}
+
+func (pf countingPidFile) Close() error {
+	pf.backend.closed++
+	return pf.PidFile.Close()
+}
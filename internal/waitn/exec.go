@@ -0,0 +1,242 @@
+package waitn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// an event of a process to wait for
+type Event string
+
+const (
+	EVENT_EXIT Event = "exit"
+	EVENT_EXEC Event = "exec"
+)
+
+// parse an event name.  Returns an *ExitError if it is not an event.
+func ParseEvent(s string) (Event, error) {
+	switch event := Event(s); event {
+	case EVENT_EXIT, EVENT_EXEC:
+		return event, nil
+	}
+	return "", &ExitError{
+		Message:      fmt.Sprintf("unknown event: %v", s),
+		ExitCode:     INPUT_ERROR,
+		DisplayUsage: true,
+		Cause:        nil}
+}
+
+// an exec or exit of the process of a pid file
+type eventResult struct {
+	pid   ResultPid
+	event Event
+	err   error
+}
+
+// the result of the event, classified as it is received while the pid files
+// are open: running for an exec
+func (r eventResult) result() Result {
+	if r.event == EVENT_EXEC {
+		return Result{Pid: r.pid, State: PROCESS_RUNNING}
+	}
+	return exitedResult(r.pid)
+}
+
+// watch the processes of started pid files for execs and exits, sending each
+// to the returned channel.  A process may send an exec and then an exit.
+// Execs are read from the proc connector if it may be used, otherwise each
+// process is polled every interval for a change in its program.  Execs before
+// watching starts are not seen.  Returns a function that stops watching and
+// closes the pid files (should be deferred).
+func watchEvents(pidFiles []PidFile, interval time.Duration) (
+	<-chan eventResult, func()) {
+	// buffered to hold every result so that no goroutine blocks after
+	// stopping.
+	c := make(chan eventResult, 2*len(pidFiles))
+	stopChan := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	wg.Add(len(pidFiles))
+	for _, pidFile := range pidFiles {
+		pidFile := pidFile
+		go func() {
+			err := pidFile.BlockUntilDoneOrClosed()
+			c <- eventResult{pid: ResultPid(pidFile.Pid()), event: EVENT_EXIT, err: err}
+			wg.Done()
+		}()
+	}
+
+	pc, err := syscalls.OpenProcConnector()
+	wg.Add(1)
+	if err == nil {
+		go func() {
+			readExecs(pc, pidFiles, c)
+			wg.Done()
+		}()
+	} else {
+		go func() {
+			pollExecs(pidFiles, interval, stopChan, c)
+			wg.Done()
+		}()
+	}
+
+	return c, sync.OnceFunc(func() {
+		close(stopChan)
+		if pc != nil {
+			if err := pc.Close(); err != nil {
+				panic(err)
+			}
+		}
+		for _, pidFile := range pidFiles {
+			if err := pidFile.Close(); err != nil {
+				panic(err)
+			}
+		}
+		wg.Wait()
+	})
+}
+
+// send the first exec of each process of pidFiles read from the proc connector
+// until it is closed
+func readExecs(pc *syscalls.ProcConnector, pidFiles []PidFile,
+	c chan<- eventResult) {
+	execed := make(map[int]bool, len(pidFiles))
+	for _, pidFile := range pidFiles {
+		execed[pidFile.Pid()] = false
+	}
+	for {
+		events, err := pc.ReadEvents()
+		if errors.Is(err, unix.ENOBUFS) {
+			// events were lost.  Their processes are reported once they exit.
+			continue
+		} else if err != nil {
+			return
+		}
+		for _, event := range events {
+			// a thread other than the leader that execs takes the leader's
+			// pid, so match the thread group
+			if event.Kind != syscalls.PROC_EVENT_EXEC {
+				continue
+			}
+			if done, ok := execed[event.Tgid]; !ok || done {
+				continue
+			}
+			execed[event.Tgid] = true
+			c <- eventResult{pid: ResultPid(event.Tgid), event: EVENT_EXEC}
+		}
+	}
+}
+
+// send the first exec of each process of pidFiles, detected by polling its
+// program every interval, until stopChan is closed
+func pollExecs(pidFiles []PidFile, interval time.Duration,
+	stopChan <-chan struct{}, c chan<- eventResult) {
+	type polled struct {
+		pidFile PidFile
+		program string
+	}
+	// read the program of each live process.  As in StartTimings, a program is
+	// only known to be the process's if it had not exited after reading /proc.
+	var live []polled
+	read := func(pidFile PidFile) (string, bool) {
+		program, err := proc.Program(pidFile.Pid())
+		if err != nil {
+			return "", false
+		}
+		done, err := pidFile.Done()
+		return program, err == nil && !done
+	}
+	for _, pidFile := range pidFiles {
+		if program, ok := read(pidFile); ok {
+			live = append(live, polled{pidFile: pidFile, program: program})
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for len(live) > 0 {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+		}
+		stillLive := live[:0]
+		for _, p := range live {
+			program, ok := read(p.pidFile)
+			if !ok {
+				// exited, and reported as such
+				continue
+			}
+			if program != p.program {
+				c <- eventResult{pid: ResultPid(p.pidFile.Pid()), event: EVENT_EXEC}
+				continue
+			}
+			stillLive = append(stillLive, p)
+		}
+		live = stillLive
+	}
+}
+
+// wait for the first process of pidFiles to exec or exit, or for the context to
+// end.  Processes are polled for execs every interval if the proc connector
+// may not be used.  Close all pid files before returning.
+func WaitForEvent(ctx context.Context, pidFiles []PidFile,
+	interval time.Duration) (Result, Event, error) {
+	if pidFiles == nil {
+		panic("WaitForEvent: pidFiles is nil")
+	}
+	c, stop := watchEvents(pidFiles, interval)
+	defer stop()
+
+	select {
+	case result := <-c:
+		if result.err != nil {
+			panic(fmt.Sprintf("error on PidFile %v: %v", result.pid, result.err))
+		}
+		return result.result(), result.event, nil
+	case <-ctx.Done():
+		return Result{}, "", contextExitError(ctx)
+	}
+}
+
+// call onResult for each process of pidFiles as it execs or, if it does not,
+// exits, until all have or the context ends.  Close all pid files before
+// returning.
+func StreamEvents(ctx context.Context, pidFiles []PidFile,
+	interval time.Duration, onResult func(Result, Event)) error {
+	if pidFiles == nil {
+		panic("StreamEvents: pidFiles is nil")
+	}
+	c, stop := watchEvents(pidFiles, interval)
+	defer stop()
+
+	// a pid given more than once is reported once
+	reported := make(map[ResultPid]bool, len(pidFiles))
+	for _, pidFile := range pidFiles {
+		reported[ResultPid(pidFile.Pid())] = false
+	}
+	for remaining := len(reported); remaining > 0; remaining-- {
+		select {
+		case result := <-c:
+			if result.err != nil {
+				panic(fmt.Sprintf("error on PidFile %v: %v", result.pid, result.err))
+			}
+			if reported[result.pid] {
+				remaining++
+				continue
+			}
+			reported[result.pid] = true
+			onResult(result.result(), result.event)
+		case <-ctx.Done():
+			return contextExitError(ctx)
+		}
+	}
+	return nil
+}
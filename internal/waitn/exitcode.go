@@ -0,0 +1,126 @@
+package waitn
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// collects the exit statuses of processes that are not our children from the
+// netlink proc connector.  Pidfds report only that a process exited.  Only
+// processes' exits are collected, not those of threads other than the leader.
+type ExitWatcher struct {
+	pc       *syscalls.ProcConnector
+	mu       sync.Mutex
+	statuses map[int]syscall.WaitStatus
+	// closed once the pid's exit is reported, for watched pids
+	exited map[int]chan struct{}
+	done   chan struct{}
+}
+
+// start collecting the exit statuses of pids.  Subscribe before opening pid
+// files so that no exit is missed.  Returns an error if the proc connector
+// cannot be used, as without CAP_NET_ADMIN.
+func WatchExits(pids []int) (*ExitWatcher, error) {
+	pc, err := syscalls.OpenProcConnector()
+	if err != nil {
+		return nil, err
+	}
+	w := &ExitWatcher{
+		pc:       pc,
+		statuses: make(map[int]syscall.WaitStatus, len(pids)),
+		exited:   make(map[int]chan struct{}, len(pids)),
+		done:     make(chan struct{})}
+	for _, pid := range pids {
+		w.exited[pid] = make(chan struct{})
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *ExitWatcher) run() {
+	defer close(w.done)
+	for {
+		events, err := w.pc.ReadEvents()
+		if errors.Is(err, unix.ENOBUFS) {
+			// events were lost.  Their processes will have no exit code.
+			continue
+		} else if err != nil {
+			return
+		}
+		w.mu.Lock()
+		for _, event := range events {
+			c, ok := w.exited[event.Pid]
+			// the exits of threads other than the leader are not the
+			// process's, and their ids are not pids
+			if event.Kind != syscalls.PROC_EVENT_EXIT || !ok ||
+				event.Tgid != event.Pid {
+				continue
+			}
+			// the first exit is of the watched process, later exits are of
+			// processes that reused its pid
+			if _, seen := w.statuses[event.Pid]; seen {
+				continue
+			}
+			w.statuses[event.Pid] = event.Status
+			close(c)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// how long to wait for an exit to be reported once its pid file is done.  The
+// kernel sends the event before the pidfd becomes readable, so this only
+// covers reading it.
+const exitEventTimeout = 100 * time.Millisecond
+
+// the exit code of a watched process that exited, as from Launched.Wait.
+// Returns false if its exit was not reported, as when it exited before
+// WatchExits or events were lost.
+func (w *ExitWatcher) ExitCode(pid int) (int, bool) {
+	return w.exitCode(pid, time.After(exitEventTimeout))
+}
+
+// the exit code of a watched process as ExitCode returns it, but without
+// waiting for its exit to be reported.  For processes that were not found and
+// so most likely exited before WatchExits.
+func (w *ExitWatcher) ReportedExitCode(pid int) (int, bool) {
+	return w.exitCode(pid, nil)
+}
+
+// the exit code of pid once reported, or false once timeout delivers.  A nil
+// timeout does not wait.
+func (w *ExitWatcher) exitCode(pid int, timeout <-chan time.Time) (int, bool) {
+	c, ok := w.exited[pid]
+	if !ok {
+		return 0, false
+	}
+	if timeout == nil {
+		select {
+		case <-c:
+		default:
+			return 0, false
+		}
+	} else {
+		select {
+		case <-c:
+		case <-timeout:
+			return 0, false
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return exitCode(w.statuses[pid]), true
+}
+
+// stop collecting exit statuses
+func (w *ExitWatcher) Stop() {
+	if err := w.pc.Close(); err != nil {
+		panic(err)
+	}
+	<-w.done
+}
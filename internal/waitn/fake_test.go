@@ -0,0 +1,191 @@
+package waitn
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// exit time of a fake process that never exits
+const fakeNever = -1
+
+// a Backend whose processes and their exits are scripted by tests.  Time is a
+// fake clock that only moves when advanced, so results do not depend on
+// scheduling or wall-clock sleeps.  It is also a TimeoutClock on that time.
+type fakeBackend struct {
+	mu    sync.Mutex
+	now   int
+	procs map[int]*fakeProcess
+	// closed and replaced whenever time advances or a pid file is closed,
+	// waking blocked pid files
+	changed chan struct{}
+}
+
+type fakeProcess struct {
+	exitAt  int
+	openErr error
+	// reading the pid file fails with readErr from readErrAt
+	readErr   error
+	readErrAt int
+	signals   []unix.Signal
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		procs:   make(map[int]*fakeProcess),
+		changed: make(chan struct{})}
+}
+
+// add a process that exits once the clock reaches exitAt, or never if
+// fakeNever.  Pids not added are not found.
+func (b *fakeBackend) spawn(pid int, exitAt int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.procs[pid] = &fakeProcess{exitAt: exitAt}
+}
+
+// fail opening a pid file for pid with err
+func (b *fakeBackend) failOpen(pid int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.procs[pid] = &fakeProcess{exitAt: fakeNever, openErr: err}
+}
+
+// fail reading the pid files of the spawned pid with err once the clock
+// reaches at
+func (b *fakeBackend) failRead(pid int, at int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.procs[pid].readErr = err
+	b.procs[pid].readErrAt = at
+}
+
+// move the clock to now, exiting processes and failing reads due by then
+func (b *fakeBackend) advance(now int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = now
+	b.wakeLocked()
+}
+
+// the signals sent to pid
+func (b *fakeBackend) signals(pid int) []unix.Signal {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.procs[pid].signals
+}
+
+// a timer firing once the clock reaches d past now, d counting as
+// time.Duration(1) per unit of fake time
+func (b *fakeBackend) StartTimer(d time.Duration) (<-chan struct{}, func()) {
+	b.mu.Lock()
+	at := b.now + int(d)
+	b.mu.Unlock()
+	fired := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			b.mu.Lock()
+			now, changed := b.now, b.changed
+			b.mu.Unlock()
+			if now >= at {
+				close(fired)
+				return
+			}
+			select {
+			case <-changed:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	return fired, sync.OnceFunc(func() { close(stopped) })
+}
+
+func (b *fakeBackend) wakeLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *fakeBackend) Open(pid int, thread bool) (PidFile, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.procs[pid]
+	if !ok {
+		return nil, unix.ESRCH
+	}
+	if p.openErr != nil {
+		return nil, p.openErr
+	}
+	return &fakePidFile{backend: b, pid: pid, proc: p}, nil
+}
+
+type fakePidFile struct {
+	backend *fakeBackend
+	pid     int
+	proc    *fakeProcess
+	// guarded by backend.mu
+	closed bool
+}
+
+func (pf *fakePidFile) Pid() int {
+	return pf.pid
+}
+
+// whether the process has exited, or the error reading it.  backend.mu must be
+// held.
+func (pf *fakePidFile) doneLocked() (bool, error) {
+	if pf.closed {
+		return false, os.ErrClosed
+	}
+	now := pf.backend.now
+	if pf.proc.readErr != nil && now >= pf.proc.readErrAt {
+		return false, pf.proc.readErr
+	}
+	return pf.proc.exitAt != fakeNever && now >= pf.proc.exitAt, nil
+}
+
+func (pf *fakePidFile) BlockUntilDoneOrClosed() error {
+	for {
+		pf.backend.mu.Lock()
+		done, err := pf.doneLocked()
+		changed := pf.backend.changed
+		pf.backend.mu.Unlock()
+		if done || err != nil {
+			return err
+		}
+		<-changed
+	}
+}
+
+func (pf *fakePidFile) Done() (bool, error) {
+	pf.backend.mu.Lock()
+	defer pf.backend.mu.Unlock()
+	return pf.doneLocked()
+}
+
+func (pf *fakePidFile) SendSignal(sig unix.Signal) error {
+	pf.backend.mu.Lock()
+	defer pf.backend.mu.Unlock()
+	if pf.closed {
+		return os.ErrClosed
+	}
+	if pf.proc.exitAt != fakeNever && pf.backend.now >= pf.proc.exitAt {
+		return unix.ESRCH
+	}
+	pf.proc.signals = append(pf.proc.signals, sig)
+	return nil
+}
+
+func (pf *fakePidFile) Close() error {
+	pf.backend.mu.Lock()
+	defer pf.backend.mu.Unlock()
+	if pf.closed {
+		return os.ErrClosed
+	}
+	pf.closed = true
+	pf.backend.wakeLocked()
+	return nil
+}
@@ -0,0 +1,183 @@
+package waitn
+
+import (
+	"context"
+	"syscall"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+)
+
+// a command run by RunJobs and its result
+type JobResult struct {
+	// position of the command in input order, starting at 1
+	Index   int
+	Command string
+	// 0 if the command could not be started
+	Pid      int
+	ExitCode int
+	// number of times the command was restarted before this run
+	Restarts int
+	// the command will be restarted.  This is not the command's final result.
+	Restarting bool
+	// zero if the command could not be started
+	Usage proc.Usage
+}
+
+// run commands with sh -c, each in its own process group, at most limit at a
+// time, calling onResult with each result in the order the commands finish.
+// next returns the next command, or false once there are no more.  Commands
+// have stdin from /dev/null and this process's stdout and stderr.
+//
+// Commands are restarted according to policy, each restart reporting the
+// result that caused it with Restarting set.  Only final results count as
+// failures.
+//
+// If haltOnFailure then once any command fails no further commands are started
+// and running commands' process groups are sent SIGTERM, then SIGKILL after
+// grace.  The same happens when the context ends.  Every started command is
+// reaped and reported before returning.
+//
+// Returns the number of failed commands and, if the context ended, an error as
+// WaitForPidFile does.
+func RunJobs(ctx context.Context, next func() (string, bool), limit int,
+	haltOnFailure bool, grace time.Duration, policy RestartPolicy,
+	onResult func(JobResult)) (int, error) {
+	if limit < 1 {
+		panic("RunJobs: limit must be positive")
+	}
+
+	// each running command's exit is waited for from its own goroutine as
+	// WaitForPidFile does, but is reaped by the loop as it is received.  Only
+	// the loop signals commands, so a reaped command's process group id, which
+	// may be reused, is never signalled.  A command to be restarted keeps its
+	// place among the limit while backing off.
+	results := make(chan JobResult)
+	restarts := make(chan int, limit)
+	running := make(map[int]*Launched)
+	// the results that caused restarts, by index, and timers to restart them
+	backingOff := make(map[int]JobResult)
+	backoffTimers := make(map[int]*time.Timer)
+	index := 0
+	exhausted := false
+	launch := func(result JobResult) {
+		launched, err := LaunchCmd(shellCommand(result.Command))
+		if err != nil {
+			result.Pid = 0
+			result.ExitCode = INPUT_ERROR
+			result.Usage = proc.Usage{}
+			go func() { results <- result }()
+			return
+		}
+		result.Pid = launched.PidFile.Pid
+		running[result.Index] = launched
+		go func() {
+			if err := launched.PidFile.BlockUntilDoneOrClosed(); err != nil {
+				panic(err)
+			}
+			results <- result
+		}()
+	}
+	start := func() {
+		command, ok := next()
+		if !ok {
+			exhausted = true
+			return
+		}
+		index++
+		launch(JobResult{Index: index, Command: command})
+	}
+
+	failed := 0
+	pending := 0
+	halting := false
+	var killTimer <-chan time.Time
+	// commands that exit as they are signalled are skipped
+	signalRunning := func(sig syscall.Signal) {
+		for _, launched := range running {
+			if err := launched.Signal(sig); err != nil {
+				panic(err)
+			}
+		}
+	}
+	var finish func(result JobResult)
+	halt := func() {
+		if halting {
+			return
+		}
+		halting = true
+		signalRunning(syscall.SIGTERM)
+		killTimer = time.After(grace)
+		// commands backing off are not restarted.  The result that caused the
+		// restart is final.
+		for index, result := range backingOff {
+			if backoffTimers[index].Stop() {
+				delete(backingOff, index)
+				delete(backoffTimers, index)
+				result.Restarting = false
+				finish(result)
+			}
+		}
+	}
+	finish = func(result JobResult) {
+		pending--
+		if result.ExitCode != 0 {
+			failed++
+			if haltOnFailure {
+				halt()
+			}
+		}
+		onResult(result)
+	}
+
+	done := ctx.Done()
+	var exErr error
+	for {
+		for !halting && !exhausted && pending < limit {
+			start()
+			if !exhausted {
+				pending++
+			}
+		}
+		if pending == 0 {
+			break
+		}
+		select {
+		case result := <-results:
+			if launched, ok := running[result.Index]; ok {
+				result.ExitCode = launched.Wait()
+				result.Usage = launched.Usage
+				delete(running, result.Index)
+			}
+			if halting || !policy.ShouldRestart(result.ExitCode, result.Restarts) {
+				finish(result)
+				continue
+			}
+			result.Restarting = true
+			onResult(result)
+			backingOff[result.Index] = result
+			backoffTimers[result.Index] = time.AfterFunc(
+				policy.Backoff(result.Restarts), func() { restarts <- result.Index })
+		case index := <-restarts:
+			result := backingOff[index]
+			delete(backingOff, index)
+			delete(backoffTimers, index)
+			if halting {
+				result.Restarting = false
+				finish(result)
+				continue
+			}
+			result.Restarts++
+			result.Restarting = false
+			launch(result)
+		case <-done:
+			done = nil
+			exErr = contextExitError(ctx)
+			halt()
+		case <-killTimer:
+			killTimer = nil
+			signalRunning(syscall.SIGKILL)
+		}
+	}
+	return failed, exErr
+}
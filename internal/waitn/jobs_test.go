@@ -0,0 +1,211 @@
+package waitn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stretchr/testify/require"
+)
+
+// returns a next function for RunJobs over commands
+func commandsOf(commands ...string) func() (string, bool) {
+	return func() (string, bool) {
+		if len(commands) == 0 {
+			return "", false
+		}
+		command := commands[0]
+		commands = commands[1:]
+		return command, true
+	}
+}
+
+// returns a command that does not exec its last command, so that the shell
+// remains the parent of a sleep, and a function returning the sleep's pid once
+// the command has run.
+func grandchildCommand(t *testing.T) (string, func() int) {
+	pidPath := filepath.Join(t.TempDir(), "pid")
+	command := fmt.Sprintf("sleep 10 & echo $! > %v; wait; true", pidPath)
+	return command, func() int {
+		s, err := os.ReadFile(pidPath)
+		require.NoError(t, err)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(s)))
+		require.NoError(t, err)
+		return pid
+	}
+}
+
+// require that pid exits.  It is no longer our descendant and so may remain a
+// zombie if nothing reaps orphans.
+func requireExits(t *testing.T, pid int) {
+	require.Eventually(t, func() bool {
+		state, err := proc.ReadState(pid)
+		if errors.Is(err, os.ErrNotExist) {
+			return true
+		}
+		require.NoError(t, err)
+		return state.State == proc.STATE_ZOMBIE
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunJobs(t *testing.T) {
+	require := require.New(t)
+
+	// finish order and exit codes
+	{
+		var results []JobResult
+		failed, err := RunJobs(context.Background(), commandsOf(
+			"sleep 0.3; exit 1",
+			"sleep 0.1",
+			"sleep 0.2; exit 2"), 3, false, time.Second, NoRestart,
+			func(result JobResult) {
+				results = append(results, result)
+			})
+		require.NoError(err)
+		require.Equal(2, failed)
+		require.Len(results, 3)
+		for i, expected := range []struct {
+			index    int
+			exitCode int
+		}{{2, 0}, {3, 2}, {1, 1}} {
+			require.Equal(expected.index, results[i].Index)
+			require.Equal(expected.exitCode, results[i].ExitCode)
+			require.NotZero(results[i].Pid)
+		}
+		require.Equal("sleep 0.1", results[0].Command)
+		require.Positive(results[0].Usage.MaxRSSKiB)
+	}
+
+	// concurrency limit: 4 jobs of 0.1s each, 2 at a time
+	{
+		start := time.Now()
+		count := 0
+		failed, err := RunJobs(context.Background(), commandsOf(
+			"sleep 0.1", "sleep 0.1", "sleep 0.1", "sleep 0.1"), 2, false,
+			time.Second, NoRestart, func(result JobResult) { count++ })
+		require.NoError(err)
+		require.Zero(failed)
+		require.Equal(4, count)
+		require.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+	}
+
+	// halt on failure terminates running jobs and starts no more
+	{
+		var results []JobResult
+		failed, err := RunJobs(context.Background(), commandsOf(
+			"exit 3", "exec sleep 10", "exec sleep 10"), 2, true, time.Second, NoRestart,
+			func(result JobResult) {
+				results = append(results, result)
+			})
+		require.NoError(err)
+		require.Equal(2, failed)
+		require.Len(results, 2)
+		require.Equal(3, results[0].ExitCode)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), results[1].ExitCode)
+	}
+
+	// halting terminates processes started by the shell
+	{
+		command, grandchild := grandchildCommand(t)
+		var results []JobResult
+		failed, err := RunJobs(context.Background(), commandsOf(
+			command, "sleep 0.1; exit 3"), 2, true, time.Second, NoRestart,
+			func(result JobResult) {
+				results = append(results, result)
+			})
+		require.NoError(err)
+		require.Equal(2, failed)
+		require.Len(results, 2)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), results[1].ExitCode)
+		requireExits(t, grandchild())
+	}
+
+	// a job exiting as another fails is reaped and reported once, not
+	// terminated.  It ignores SIGTERM so its exit code is the same whichever
+	// the loop receives first.
+	for i := 0; i < 5; i++ {
+		exitCodes := make(map[int]int)
+		failed, err := RunJobs(context.Background(), commandsOf(
+			`trap "" TERM; sleep 0.1`, "sleep 0.1; exit 3", "exec sleep 10"), 3,
+			true, time.Second, NoRestart, func(result JobResult) {
+				require.NotContains(exitCodes, result.Index)
+				require.NotZero(result.Pid)
+				exitCodes[result.Index] = result.ExitCode
+			})
+		require.NoError(err)
+		require.Equal(2, failed)
+		require.Equal(map[int]int{
+			1: 0, 2: 3, 3: SIGNAL_EXIT_BASE + int(syscall.SIGTERM)}, exitCodes)
+	}
+
+	// restarts on failure, each with a new pid
+	{
+		policy := RestartPolicy{
+			Mode:        RESTART_ON_FAILURE,
+			MaxRestarts: 2,
+			MinBackoff:  10 * time.Millisecond,
+			MaxBackoff:  20 * time.Millisecond}
+		var results []JobResult
+		failed, err := RunJobs(context.Background(), commandsOf(
+			"exit 1", "true"), 1, false, time.Second, policy,
+			func(result JobResult) {
+				results = append(results, result)
+			})
+		require.NoError(err)
+		require.Equal(1, failed)
+		require.Len(results, 4)
+		pids := make(map[int]bool)
+		for i, expected := range []struct {
+			index      int
+			restarts   int
+			restarting bool
+		}{{1, 0, true}, {1, 1, true}, {1, 2, false}, {2, 0, false}} {
+			require.Equal(expected.index, results[i].Index)
+			require.Equal(expected.restarts, results[i].Restarts)
+			require.Equal(expected.restarting, results[i].Restarting)
+			pids[results[i].Pid] = true
+		}
+		require.Len(pids, 4)
+	}
+
+	// halting while backing off reports the last result as final
+	{
+		policy := RestartPolicy{
+			Mode:        RESTART_ALWAYS,
+			MaxRestarts: -1,
+			MinBackoff:  10 * time.Second,
+			MaxBackoff:  10 * time.Second}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var results []JobResult
+		failed, err := RunJobs(ctx, commandsOf("exit 4"), 1, false,
+			time.Second, policy, func(result JobResult) {
+				results = append(results, result)
+			})
+		require.ErrorIs(err, TimeoutErr)
+		require.Equal(1, failed)
+		require.Len(results, 2)
+		require.True(results[0].Restarting)
+		require.False(results[1].Restarting)
+		require.Equal(4, results[1].ExitCode)
+	}
+
+	// timeout
+	{
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		count := 0
+		_, err := RunJobs(ctx, commandsOf("exec sleep 10", "exec sleep 10"), 1, false,
+			time.Second, NoRestart, func(result JobResult) { count++ })
+		require.ErrorIs(err, TimeoutErr)
+		require.Equal(1, count)
+	}
+}
@@ -0,0 +1,256 @@
+package waitn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// a process started by waitn.  Its pid file is opened before the process can
+// be reaped and so it always refers to the correct process.
+// Wait must be called exactly once to reap the process and close the pid file.
+type Launched struct {
+	Cmd     *exec.Cmd
+	PidFile *syscalls.PidFile
+	// resource usage of the process and its reaped descendants, set by Wait
+	Usage proc.Usage
+}
+
+// start the command with this process's stdin, stdout, and stderr.  Returns
+// an error if the command cannot be started.
+func Launch(args []string) (*Launched, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return LaunchCmd(cmd)
+}
+
+// a command run with sh -c in its own process group, so that signals sent by
+// Launched.Signal reach any processes the shell starts.  stdin is /dev/null and
+// stdout and stderr are this process's.
+func shellCommand(command string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// start the command.  Its stdin, stdout, and stderr must be nil or *os.File as
+// it is reaped by Launched.Wait and not cmd.Wait.  Returns an error if the
+// command cannot be started.
+func LaunchCmd(cmd *exec.Cmd) (*Launched, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// the child cannot be reaped until we wait for it, so its pid cannot be
+	// reused and pidfd_open must succeed.
+	pidFile := &syscalls.PidFile{Pid: cmd.Process.Pid}
+	if err := pidFile.Start(); err != nil {
+		panic(err)
+	}
+	return &Launched{Cmd: cmd, PidFile: pidFile}, nil
+}
+
+// block until the process exits, reap it with waitid(P_PIDFD), record its
+// Usage, and close its pid file.  Returns the exit code as a shell reports it:
+// the exit status, or 128 plus the signal number if killed by a signal.
+func (l *Launched) Wait() int {
+	if err := l.PidFile.BlockUntilDoneOrClosed(); err != nil {
+		panic(err)
+	}
+	var rusage unix.Rusage
+	status, err := l.PidFile.Wait(&rusage)
+	if err != nil {
+		panic(err)
+	}
+	l.Usage = proc.UsageFromRusage(&rusage)
+	if err := l.PidFile.Close(); err != nil {
+		panic(err)
+	}
+	if err := l.Cmd.Process.Release(); err != nil {
+		panic(err)
+	}
+	return exitCode(status)
+}
+
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return SIGNAL_EXIT_BASE + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
+
+// send sig to the process, or to its process group if it was started in its
+// own.  Call it only before the process is reaped: once reaped its pid, and so
+// its process group id, may be reused.  Returns nil if there is nothing left to
+// signal.
+func (l *Launched) Signal(sig syscall.Signal) error {
+	var err error
+	if l.Cmd.SysProcAttr != nil && l.Cmd.SysProcAttr.Setpgid {
+		err = unix.Kill(-l.PidFile.Pid, sig)
+	} else {
+		err = l.PidFile.SendSignal(sig)
+	}
+	if errors.Is(err, unix.ESRCH) || errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// send sig to the process as Signal does, and SIGKILL if it has not exited
+// after grace.  Reap the process and return its exit code as Wait does.  The
+// process is reaped only after it is last signalled.
+func (l *Launched) Terminate(sig syscall.Signal, grace time.Duration) int {
+	done := make(chan struct{})
+	go func() {
+		if err := l.PidFile.BlockUntilDoneOrClosed(); err != nil {
+			panic(err)
+		}
+		close(done)
+	}()
+
+	sendSignal := func(sig syscall.Signal) {
+		if err := l.Signal(sig); err != nil {
+			panic(err)
+		}
+	}
+	sendSignal(sig)
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		sendSignal(unix.SIGKILL)
+	}
+	return l.Wait()
+}
+
+// a run of the command supervised by Supervise and its result
+type SuperviseResult struct {
+	// 0 if the command could not be restarted
+	Pid      int
+	ExitCode int
+	// number of times the command was restarted before this run
+	Restarts int
+	// the command will be restarted.  This is not the command's final result.
+	Restarting bool
+	// zero if the command could not be restarted
+	Usage proc.Usage
+}
+
+// run worker until it or any watched process exits, or the context ends.
+// If the worker exits first and policy does not restart it return its exit
+// code and a zero Result.  If policy restarts it, launch worker's command again
+// after its backoff.  If a watched process exits first terminate the worker
+// with SIGTERM, then SIGKILL after grace, and return the worker's exit code and
+// the watched result.  If the context ends terminate the worker the same way and
+// return an error as WaitForPidFile does.  A watched process exiting or the
+// context ending while backing off returns the last exit code.  If the worker
+// cannot be restarted return an *ExitError with INPUT_ERROR.
+//
+// onResult is called with the result of each run, as RunJobs reports results:
+// runs causing restarts have Restarting set and the final result is reported
+// exactly once without it.
+//
+// backend opens the pid files waiting for the worker to exit.  watched pid files
+// are closed.  worker is reaped.
+func Supervise(ctx context.Context, backend Backend, worker *Launched,
+	watched []PidFile, grace time.Duration, policy RestartPolicy,
+	onResult func(SuperviseResult)) (int, Result, error) {
+	// the watched pid files stay open while the worker restarts.  Cancelling
+	// watchCtx closes them.
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	type watchResult struct {
+		result Result
+		err    error
+	}
+	watchResults := make(chan watchResult, 1)
+	go func() {
+		result, err := WaitForPidFile(watchCtx, watched)
+		watchResults <- watchResult{result: result, err: err}
+	}()
+	stopWatching := func() {
+		cancelWatch()
+		<-watchResults
+	}
+
+	result := SuperviseResult{}
+	for {
+		result.Pid = worker.PidFile.Pid
+		// race a pid file of our own so that the worker's may still be used to
+		// signal and reap it.
+		race, err := backend.Open(worker.PidFile.Pid, false)
+		if err != nil {
+			panic(err)
+		}
+		exited := make(chan error, 1)
+		go func() {
+			exited <- race.BlockUntilDoneOrClosed()
+		}()
+
+		select {
+		case err := <-exited:
+			if err != nil {
+				panic(fmt.Sprintf("error on PidFile %v: %v", race.Pid(), err))
+			}
+			if err := race.Close(); err != nil {
+				panic(err)
+			}
+			result.ExitCode = worker.Wait()
+			result.Usage = worker.Usage
+		case watch := <-watchResults:
+			if err := race.Close(); err != nil {
+				panic(err)
+			}
+			<-exited
+			result.ExitCode = worker.Terminate(unix.SIGTERM, grace)
+			result.Usage = worker.Usage
+			onResult(result)
+			return result.ExitCode, watch.result, watch.err
+		}
+
+		if !policy.ShouldRestart(result.ExitCode, result.Restarts) {
+			stopWatching()
+			onResult(result)
+			return result.ExitCode, Result{}, nil
+		}
+		result.Restarting = true
+		onResult(result)
+		result.Restarting = false
+		backoff := time.NewTimer(policy.Backoff(result.Restarts))
+		select {
+		case <-backoff.C:
+		case watch := <-watchResults:
+			backoff.Stop()
+			onResult(result)
+			return result.ExitCode, watch.result, watch.err
+		}
+		result.Restarts++
+		worker, err = Launch(worker.Cmd.Args)
+		if err != nil {
+			stopWatching()
+			result.Pid = 0
+			result.ExitCode = INPUT_ERROR
+			result.Usage = proc.Usage{}
+			onResult(result)
+			return INPUT_ERROR, Result{}, &ExitError{
+				Message:      "restart command",
+				ExitCode:     INPUT_ERROR,
+				DisplayUsage: false,
+				Cause:        err}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package waitn
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaunch(t *testing.T) {
+	require := require.New(t)
+
+	// exit code
+	{
+		launched, err := Launch([]string{"sh", "-c", "exit 3"})
+		require.NoError(err)
+		require.Equal(3, launched.Wait())
+	}
+
+	// killed by a signal
+	{
+		launched, err := Launch([]string{"sleep", "10"})
+		require.NoError(err)
+		code := launched.Terminate(syscall.SIGTERM, 5*time.Second)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), code)
+	}
+
+	// ignores SIGTERM, killed after grace
+	{
+		launched, err := Launch([]string{"sh", "-c", "trap '' TERM; sleep 1"})
+		require.NoError(err)
+		// let sh set up its trap
+		time.Sleep(100 * time.Millisecond)
+		code := launched.Terminate(syscall.SIGTERM, 100*time.Millisecond)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGKILL), code)
+	}
+
+	// not found
+	{
+		launched, err := Launch([]string{"/nonexistent/command"})
+		require.Error(err)
+		require.Nil(launched)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	require := require.New(t)
+
+	// worker exits first
+	{
+		watchCtx, cancelWatch := context.WithCancel(context.Background())
+		defer cancelWatch()
+		cmd, err := createTestSleep(watchCtx, "10")
+		require.NoError(err)
+		pidFiles, _, err := SetupPidFiles(PidfdBackend, targetsOf(cmd.Process.Pid), UNKNOWN_ERROR)
+		require.NoError(err)
+
+		worker, err := Launch([]string{"sh", "-c", "sleep 0.1; exit 4"})
+		require.NoError(err)
+		code, result, err := Supervise(context.Background(), PidfdBackend,
+			worker, pidFiles, time.Second, NoRestart, func(SuperviseResult) {})
+		require.NoError(err)
+		require.EqualValues(0, result.Pid)
+		require.Equal(4, code)
+
+		// watched process is left alone
+		require.NoError(cmd.Process.Signal(syscall.Signal(0)))
+		cancelWatch()
+		cmd.Wait()
+	}
+
+	// watched process exits first
+	{
+		cmd, err := createTestSleep(context.Background(), "0.1")
+		require.NoError(err)
+		pidFiles, _, err := SetupPidFiles(PidfdBackend, targetsOf(cmd.Process.Pid), UNKNOWN_ERROR)
+		require.NoError(err)
+
+		worker, err := Launch([]string{"sleep", "10"})
+		require.NoError(err)
+		code, result, err := Supervise(context.Background(), PidfdBackend,
+			worker, pidFiles, time.Second, NoRestart, func(SuperviseResult) {})
+		require.NoError(err)
+		require.EqualValues(cmd.Process.Pid, result.Pid)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), code)
+		cmd.Wait()
+	}
+
+	// timeout
+	{
+		watchCtx, cancelWatch := context.WithCancel(context.Background())
+		defer cancelWatch()
+		cmd, err := createTestSleep(watchCtx, "10")
+		require.NoError(err)
+		pidFiles, _, err := SetupPidFiles(PidfdBackend, targetsOf(cmd.Process.Pid), UNKNOWN_ERROR)
+		require.NoError(err)
+
+		worker, err := Launch([]string{"sleep", "10"})
+		require.NoError(err)
+		waitCtx, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancelTimeout()
+		code, result, err := Supervise(waitCtx, PidfdBackend, worker, pidFiles,
+			time.Second, NoRestart, func(SuperviseResult) {})
+		require.ErrorIs(err, TimeoutErr)
+		require.EqualValues(0, result.Pid)
+		require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), code)
+		cancelWatch()
+		cmd.Wait()
+	}
+
+	// worker restarts until the policy gives up
+	{
+		watchCtx, cancelWatch := context.WithCancel(context.Background())
+		defer cancelWatch()
+		cmd, err := createTestSleep(watchCtx, "10")
+		require.NoError(err)
+		pidFiles, _, err := SetupPidFiles(PidfdBackend, targetsOf(cmd.Process.Pid), UNKNOWN_ERROR)
+		require.NoError(err)
+
+		policy := RestartPolicy{
+			Mode:        RESTART_ON_FAILURE,
+			MaxRestarts: 2,
+			MinBackoff:  10 * time.Millisecond,
+			MaxBackoff:  10 * time.Millisecond}
+		var results []SuperviseResult
+		worker, err := Launch([]string{"sh", "-c", "exit 5"})
+		require.NoError(err)
+		code, result, err := Supervise(context.Background(), PollBackend, worker, pidFiles,
+			time.Second, policy, func(result SuperviseResult) {
+				results = append(results, result)
+			})
+		require.NoError(err)
+		require.EqualValues(0, result.Pid)
+		require.Equal(5, code)
+		require.Len(results, 3)
+		pids := make(map[int]bool)
+		for i, result := range results {
+			require.Equal(5, result.ExitCode)
+			require.Equal(i, result.Restarts)
+			require.Equal(i < 2, result.Restarting)
+			require.Positive(result.Usage.MaxRSSKiB)
+			pids[result.Pid] = true
+		}
+		require.Len(pids, 3)
+
+		require.NoError(cmd.Process.Signal(syscall.Signal(0)))
+		cancelWatch()
+		cmd.Wait()
+	}
+
+	// watched process exits while the worker backs off
+	{
+		cmd, err := createTestSleep(context.Background(), "0.1")
+		require.NoError(err)
+		pidFiles, _, err := SetupPidFiles(PidfdBackend, targetsOf(cmd.Process.Pid), UNKNOWN_ERROR)
+		require.NoError(err)
+
+		policy := RestartPolicy{
+			Mode:        RESTART_ALWAYS,
+			MaxRestarts: -1,
+			MinBackoff:  10 * time.Second,
+			MaxBackoff:  10 * time.Second}
+		var results []SuperviseResult
+		worker, err := Launch([]string{"true"})
+		require.NoError(err)
+		code, result, err := Supervise(context.Background(), PollBackend, worker, pidFiles,
+			time.Second, policy, func(result SuperviseResult) {
+				results = append(results, result)
+			})
+		require.NoError(err)
+		require.EqualValues(cmd.Process.Pid, result.Pid)
+		require.Equal(0, code)
+		// the run that caused the restart is final
+		require.Len(results, 2)
+		require.True(results[0].Restarting)
+		require.False(results[1].Restarting)
+		require.Equal(results[0].Pid, results[1].Pid)
+		cmd.Wait()
+	}
+}
@@ -0,0 +1,50 @@
+package waitn
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+)
+
+// the path of the pid namespace file for -pidns, which is either a path or the
+// pid of a process whose namespace to use
+func PidNamespacePath(arg string) string {
+	if pid, err := strconv.Atoi(arg); err == nil {
+		return fmt.Sprintf("/proc/%v/ns/pid", pid)
+	}
+	return arg
+}
+
+// translate targets whose pids are in the pid namespace at path to pids in our
+// own namespace, setting each target's NsPid to its original pid.  Pids that
+// no process in the namespace has are given Pid 0 and are not found when
+// setting up pid files.  Returns an *ExitError if the namespace cannot be
+// read.
+func TranslateTargets(targets []Target, path string) error {
+	ns, err := proc.PidNamespaceOf(path)
+	if err == nil {
+		var hostPids map[int]int
+		hostPids, err = proc.HostPids(ns)
+		if err == nil {
+			for i := range targets {
+				targets[i].NsPid = targets[i].Pid
+				targets[i].Pid = hostPids[targets[i].NsPid]
+			}
+			return nil
+		}
+	}
+	return &ExitError{
+		Message:      "pid namespace",
+		ExitCode:     INPUT_ERROR,
+		DisplayUsage: false,
+		Cause:        err}
+}
+
+// whether the process of a target translated from another pid namespace still
+// has the target's pid in that namespace.  The caller must ensure that the pid
+// still refers to the intended process once this returns.
+func hasNsPid(target Target) bool {
+	nsPids, err := proc.NSpids(target.Pid)
+	return err == nil && nsPids[len(nsPids)-1] == target.NsPid
+}
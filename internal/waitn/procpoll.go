@@ -0,0 +1,170 @@
+package waitn
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// the backend polling each process with kill(pid, 0) and /proc/<pid>/stat, for
+// kernels without pidfd_open (before Linux 5.3) or seccomp profiles that block
+// it.  Each pid file is polled at an interval doubling from
+// pollMinInterval to pollMaxInterval so that short-lived processes are seen
+// promptly and long-lived ones cost little.
+var PollBackend Backend = pollBackend{}
+
+const (
+	pollMinInterval = time.Millisecond
+	pollMaxInterval = 100 * time.Millisecond
+)
+
+type pollBackend struct{}
+
+// Without /proc processes are polled with kill alone: a reused pid is not
+// detected and a zombie is not done until reaped.  Processes of other users
+// that /proc hides, as with hidepid, are ErrInvisible.
+func (pollBackend) Open(pid int, thread bool) (PidFile, error) {
+	if err := unix.Kill(pid, 0); err == unix.ESRCH {
+		return nil, err
+	}
+	pf := &polledPidFile{pid: pid, thread: thread, closed: make(chan struct{})}
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		return pf, nil
+	}
+	state, err := proc.ReadState(pid)
+	if err != nil {
+		return nil, procOpenErr(pid, err)
+	}
+	if !thread {
+		tgid, err := proc.Tgid(pid)
+		if err != nil {
+			return nil, procOpenErr(pid, err)
+		}
+		if tgid != pid {
+			return nil, syscalls.ErrNotThreadGroupLeader
+		}
+	}
+	pf.procfs = true
+	pf.startTicks = state.StartTicks
+	return pf, nil
+}
+
+// the error opening pid when reading /proc/<pid> failed with err.  A process
+// kill still finds but /proc does not list, or does not let us read, is hidden
+// from us rather than gone.
+func procOpenErr(pid int, err error) error {
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	if unix.Kill(pid, 0) == unix.ESRCH {
+		return unix.ESRCH
+	}
+	return ErrInvisible
+}
+
+// a pid file polling its process
+type polledPidFile struct {
+	pid    int
+	thread bool
+	// whether /proc is mounted, and the start time of the process read from it
+	procfs     bool
+	startTicks uint64
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func (pf *polledPidFile) Pid() int {
+	return pf.pid
+}
+
+// whether the process has exited, as a pidfd becomes readable: a zombie has
+// exited, but a thread group leader that exited before its other threads has
+// not.  A pid reused by another process means ours exited.
+func (pf *polledPidFile) exited() bool {
+	if err := unix.Kill(pf.pid, 0); err == unix.ESRCH {
+		return true
+	}
+	if !pf.procfs {
+		return false
+	}
+	state, err := proc.ReadState(pf.pid)
+	if err != nil {
+		// exited and reaped since kill
+		return true
+	}
+	if state.StartTicks != pf.startTicks {
+		return true
+	}
+	switch state.State {
+	case proc.STATE_DEAD:
+		return true
+	case proc.STATE_ZOMBIE:
+		if pf.thread {
+			return true
+		}
+		tasks, err := os.ReadDir(fmt.Sprintf("/proc/%v/task", pf.pid))
+		return err != nil || len(tasks) <= 1
+	}
+	return false
+}
+
+func (pf *polledPidFile) isClosed() bool {
+	select {
+	case <-pf.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pf *polledPidFile) BlockUntilDoneOrClosed() error {
+	interval := pollMinInterval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-pf.closed:
+			return os.ErrClosed
+		case <-timer.C:
+		}
+		if pf.exited() {
+			return nil
+		}
+		timer.Reset(interval)
+		interval = min(2*interval, pollMaxInterval)
+	}
+}
+
+func (pf *polledPidFile) Done() (bool, error) {
+	if pf.isClosed() {
+		return false, os.ErrClosed
+	}
+	return pf.exited(), nil
+}
+
+// unlike pidfd_send_signal this may signal another process that reused the pid
+// between checking that ours has not exited and sending the signal
+func (pf *polledPidFile) SendSignal(sig unix.Signal) error {
+	if pf.isClosed() {
+		return os.ErrClosed
+	}
+	if pf.exited() {
+		return unix.ESRCH
+	}
+	return unix.Kill(pf.pid, sig)
+}
+
+func (pf *polledPidFile) Close() error {
+	err := os.ErrClosed
+	pf.closeOnce.Do(func() {
+		close(pf.closed)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,124 @@
+package waitn
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPollBackend(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	pid := cmd.Process.Pid
+
+	_, err := PollBackend.Open(1<<30, false)
+	require.ErrorIs(err, unix.ESRCH)
+
+	pidFiles, result, err := SetupPidFiles(PollBackend, targetsOf(pid), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.Zero(result)
+	done, err := pidFiles[0].Done()
+	require.NoError(err)
+	require.False(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = WaitForPidFile(ctx, pidFiles)
+	require.ErrorIs(err, TimeoutErr)
+	_, err = pidFiles[0].Done()
+	require.ErrorIs(err, os.ErrClosed)
+
+	// a zombie has terminated, as for a pidfd
+	pidFiles, _, err = SetupPidFiles(PollBackend, targetsOf(pid), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.NoError(SignalPidFiles(pidFiles, syscall.SIGTERM))
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err = WaitForPidFile(ctx, pidFiles)
+	require.NoError(err)
+	require.Equal(ResultPid(pid), result.Pid)
+
+	pidFile, err := PollBackend.Open(pid, false)
+	require.NoError(err)
+	require.ErrorIs(pidFile.SendSignal(syscall.SIGTERM), unix.ESRCH)
+	require.NoError(pidFile.Close())
+	require.ErrorIs(pidFile.Close(), os.ErrClosed)
+}
+
+func TestPollBackendThread(t *testing.T) {
+	require := require.New(t)
+
+	tids := make(chan int)
+	release := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		tids <- unix.Gettid()
+		<-release
+	}()
+	tid := <-tids
+	defer close(release)
+	if tid == os.Getpid() {
+		t.Skip("goroutine locked to the main thread")
+	}
+
+	_, err := PollBackend.Open(tid, false)
+	require.ErrorIs(err, syscalls.ErrNotThreadGroupLeader)
+
+	pidFiles, _, err := SetupPidFiles(PollBackend,
+		[]Target{{Pid: tid, Thread: true}}, UNKNOWN_ERROR)
+	require.NoError(err)
+	release <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := WaitForPidFile(ctx, pidFiles)
+	require.NoError(err)
+	require.Equal(ResultPid(tid), result.Pid)
+}
+
+func TestAutoBackend(t *testing.T) {
+	require := require.New(t)
+
+	pidfd := newFakeBackend()
+	pidfd.spawn(3, fakeNever)
+	pidfd.failOpen(4, unix.ESRCH)
+	pidfd.failOpen(5, unix.ENOSYS)
+	poll := newFakeBackend()
+	poll.spawn(5, fakeNever)
+	poll.spawn(3, 0)
+	backend := &autoBackend{pidfd: pidfd, poll: poll}
+
+	// pidfds are used while they may be
+	pidFiles, notFound, err := SetupAllPidFiles(backend, targetsOf(3, 4))
+	require.NoError(err)
+	require.Equal([]ResultPid{4}, pidsOf(notFound))
+	require.Equal([]ResultPid(nil), pidsOf(PollPidFiles(pidFiles)))
+
+	// then polling, for every later pid
+	pidFiles, notFound, err = SetupAllPidFiles(backend, targetsOf(5, 3))
+	require.NoError(err)
+	require.Empty(notFound)
+	require.Equal([]ResultPid{3}, pidsOf(PollPidFiles(pidFiles)))
+
+	backend = &autoBackend{pidfd: pidfd, poll: poll}
+	pidfd.failOpen(6, unix.EPERM)
+	poll.spawn(6, 0)
+	pidFiles, _, err = SetupAllPidFiles(backend, targetsOf(6))
+	require.NoError(err)
+	require.Equal([]ResultPid{6}, pidsOf(PollPidFiles(pidFiles)))
+
+	_, err = ParseBackend("kqueue")
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	require.Equal(INPUT_ERROR, exitErr.ExitCode)
+}
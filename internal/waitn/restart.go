@@ -0,0 +1,84 @@
+package waitn
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type RestartMode string
+
+const (
+	RESTART_NO         RestartMode = "no"
+	RESTART_ON_FAILURE RestartMode = "on-failure"
+	RESTART_ALWAYS     RestartMode = "always"
+)
+
+// when and how often to restart a launched command once it exits
+type RestartPolicy struct {
+	Mode RestartMode
+	// negative for no limit
+	MaxRestarts int
+	// delay before the first restart, doubling for each further restart up to
+	// MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// never restart
+var NoRestart = RestartPolicy{Mode: RESTART_NO}
+
+func ParseRestartMode(s string) (RestartMode, error) {
+	switch mode := RestartMode(s); mode {
+	case RESTART_NO, RESTART_ON_FAILURE, RESTART_ALWAYS:
+		return mode, nil
+	}
+	return "", fmt.Errorf("restart mode %q: expected no, on-failure, or always", s)
+}
+
+// parse a backoff of the form <min>..<max>, or a single duration used for both
+func ParseBackoff(s string) (time.Duration, time.Duration, error) {
+	minS, maxS, found := strings.Cut(s, "..")
+	if !found {
+		maxS = minS
+	}
+	min, err := time.ParseDuration(minS)
+	if err != nil {
+		return 0, 0, fmt.Errorf("backoff %q: %w", s, err)
+	}
+	max, err := time.ParseDuration(maxS)
+	if err != nil {
+		return 0, 0, fmt.Errorf("backoff %q: %w", s, err)
+	}
+	if min < 0 || max < min {
+		return 0, 0, fmt.Errorf("backoff %q: expected 0 <= min <= max", s)
+	}
+	return min, max, nil
+}
+
+// whether a command that exited with exitCode after being restarted restarts
+// times should be restarted again
+func (p RestartPolicy) ShouldRestart(exitCode int, restarts int) bool {
+	if p.MaxRestarts >= 0 && restarts >= p.MaxRestarts {
+		return false
+	}
+	switch p.Mode {
+	case RESTART_ON_FAILURE:
+		return exitCode != 0
+	case RESTART_ALWAYS:
+		return true
+	}
+	return false
+}
+
+// the delay before restarting a command already restarted restarts times
+func (p RestartPolicy) Backoff(restarts int) time.Duration {
+	backoff := p.MinBackoff
+	for i := 0; i < restarts && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
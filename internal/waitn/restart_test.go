@@ -0,0 +1,56 @@
+package waitn
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBackoff(t *testing.T) {
+	require := require.New(t)
+
+	min, max, err := ParseBackoff("1s..30s")
+	require.NoError(err)
+	require.Equal(time.Second, min)
+	require.Equal(30*time.Second, max)
+
+	min, max, err = ParseBackoff("100ms")
+	require.NoError(err)
+	require.Equal(100*time.Millisecond, min)
+	require.Equal(100*time.Millisecond, max)
+
+	for _, s := range []string{"", "1s..", "x..1s", "2s..1s", "-1s..1s"} {
+		_, _, err = ParseBackoff(s)
+		require.Error(err, s)
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	require := require.New(t)
+
+	policy := RestartPolicy{
+		Mode:        RESTART_ON_FAILURE,
+		MaxRestarts: 2,
+		MinBackoff:  time.Second,
+		MaxBackoff:  5 * time.Second}
+	require.True(policy.ShouldRestart(1, 0))
+	require.True(policy.ShouldRestart(1, 1))
+	require.False(policy.ShouldRestart(1, 2))
+	require.False(policy.ShouldRestart(0, 0))
+
+	policy.Mode = RESTART_ALWAYS
+	require.True(policy.ShouldRestart(0, 0))
+	policy.MaxRestarts = -1
+	require.True(policy.ShouldRestart(0, 100))
+	require.False(NoRestart.ShouldRestart(1, 0))
+
+	for restarts, expected := range []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second,
+		5 * time.Second} {
+		require.Equal(expected, policy.Backoff(restarts))
+	}
+
+	_, err := ParseRestartMode("sometimes")
+	require.Error(err)
+}
@@ -0,0 +1,103 @@
+package waitn
+
+import (
+	"errors"
+	"os"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"golang.org/x/sys/unix"
+)
+
+// what waitn saw of a target's process when reporting it
+type ProcessState string
+
+const (
+	// the process has not exited, as for -until exec results
+	PROCESS_RUNNING ProcessState = "running"
+	// the process exited but its parent has not reaped it
+	PROCESS_ZOMBIE ProcessState = "zombie"
+	// no process has the pid: it exited and was reaped, or never existed
+	PROCESS_GONE ProcessState = "gone"
+	// a process may have the pid but waitn cannot see it, as with /proc
+	// mounted with hidepid or from another pid namespace
+	PROCESS_INVISIBLE ProcessState = "invisible"
+)
+
+// returned by Backend.Open when a process may have the pid but cannot be seen
+var ErrInvisible = errors.New("process not visible")
+
+// the state of a target's process that could not be opened, with either
+// unix.ESRCH or ErrInvisible.  ESRCH means no process has the pid in our pid
+// namespace, but /proc of another namespace, such as a host's shared with a
+// container, may list one that the pid was taken from.
+func unknownState(target Target, err error) ProcessState {
+	if errors.Is(err, ErrInvisible) {
+		return PROCESS_INVISIBLE
+	}
+	if target.Pid != 0 && !proc.IsOwnPidNamespace() {
+		if listed, err := proc.Listed(target.Pid); listed || err != nil {
+			return PROCESS_INVISIBLE
+		}
+	}
+	return PROCESS_GONE
+}
+
+// the result of a process found to have exited, classified now, before its
+// parent has more time to reap it
+func exitedResult(pid ResultPid) Result {
+	return Result{Pid: pid, State: exitedState(pid)}
+}
+
+// the state of a process that exited: a zombie until its parent reaps it, and
+// gone once it has, even if another process has since reused the pid.  Without
+// /proc a process still having its pid is presumed a zombie.
+func exitedState(pid ResultPid) ProcessState {
+	if err := unix.Kill(int(pid), 0); err == unix.ESRCH {
+		return PROCESS_GONE
+	}
+	if !proc.IsOwnPidNamespace() {
+		return PROCESS_ZOMBIE
+	}
+	state, err := proc.ReadState(int(pid))
+	if errors.Is(err, os.ErrPermission) ||
+		(err == nil && state.State == proc.STATE_ZOMBIE) {
+		return PROCESS_ZOMBIE
+	}
+	return PROCESS_GONE
+}
+
+// which pids that cannot be waited for are errors, exiting with
+// PROCESS_NOT_FOUND_ERROR once they are printed
+type UnknownPolicy int
+
+const (
+	// no pid is an error.  Processes not found presumably terminated.
+	UNKNOWN_OK UnknownPolicy = iota
+	// every pid not found is an error
+	UNKNOWN_ERROR
+	// only pids of processes that may exist but are invisible are errors
+	UNKNOWN_INVISIBLE_ERROR
+)
+
+func (policy UnknownPolicy) isError(state ProcessState) bool {
+	switch policy {
+	case UNKNOWN_ERROR:
+		return true
+	case UNKNOWN_INVISIBLE_ERROR:
+		return state == PROCESS_INVISIBLE
+	}
+	return false
+}
+
+// ProcessNotFoundErr if policy makes any of the unknown results an error,
+// otherwise nil.  Unknown results are those returned when setting up pid files.
+func UnknownPidsErr(policy UnknownPolicy, unknown []Result) error {
+	for _, result := range unknown {
+		if policy.isError(result.State) {
+			// this error simply changes the exit code while still providing
+			// a result
+			return ProcessNotFoundErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package waitn
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnknownState(t *testing.T) {
+	require := require.New(t)
+	backend := newFakeBackend()
+	backend.spawn(3, fakeNever)
+	backend.failOpen(7, ErrInvisible)
+
+	targets := targetsOf(5, 7, 3)
+	pidFiles, notFound, err := SetupAllPidFiles(backend, targets)
+	require.NoError(err)
+	require.Len(pidFiles, 1)
+	require.NoError(pidFiles[0].Close())
+	require.Equal([]Result{
+		{Pid: 5, State: PROCESS_GONE, NotFound: true},
+		{Pid: 7, State: PROCESS_INVISIBLE, NotFound: true},
+	}, notFound)
+
+	require.NoError(UnknownPidsErr(UNKNOWN_OK, notFound))
+	require.ErrorIs(UnknownPidsErr(UNKNOWN_ERROR, notFound[:1]),
+		ProcessNotFoundErr)
+	require.NoError(UnknownPidsErr(UNKNOWN_INVISIBLE_ERROR, notFound[:1]))
+	require.ErrorIs(UnknownPidsErr(UNKNOWN_INVISIBLE_ERROR, notFound),
+		ProcessNotFoundErr)
+
+	// only invisible processes are errors
+	pidFiles, result, err := SetupPidFiles(backend, targetsOf(5, 3),
+		UNKNOWN_INVISIBLE_ERROR)
+	require.Nil(pidFiles)
+	require.Equal(Result{Pid: 5, State: PROCESS_GONE, NotFound: true}, result)
+	require.NoError(err)
+	pidFiles, result, err = SetupPidFiles(backend, targetsOf(7, 3),
+		UNKNOWN_INVISIBLE_ERROR)
+	require.Nil(pidFiles)
+	require.Equal(Result{Pid: 7, State: PROCESS_INVISIBLE, NotFound: true}, result)
+	require.ErrorIs(err, ProcessNotFoundErr)
+}
+
+func TestExitedState(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("true")
+	require.NoError(cmd.Start())
+	pid := cmd.Process.Pid
+	require.Eventually(func() bool {
+		state, err := proc.ReadState(pid)
+		return err == nil && state.State == proc.STATE_ZOMBIE
+	}, 5*time.Second, time.Millisecond)
+	require.Equal(PROCESS_ZOMBIE, exitedState(ResultPid(pid)))
+
+	require.NoError(cmd.Wait())
+	require.Equal(PROCESS_GONE, exitedState(ResultPid(pid)))
+}
+
+// results are classified when they are found, not when they are printed
+func TestResultState(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("true")
+	require.NoError(cmd.Start())
+	pidFile, err := PidfdBackend.Open(cmd.Process.Pid, false)
+	require.NoError(err)
+	result, err := WaitForPidFile(context.Background(), []PidFile{pidFile})
+	require.NoError(err)
+	require.Equal(Result{Pid: ResultPid(cmd.Process.Pid), State: PROCESS_ZOMBIE},
+		result)
+	require.NoError(cmd.Wait())
+}
@@ -0,0 +1,127 @@
+package waitn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// the clock timeouts are measured on.  Tests may advance a fake clock instead
+// of sleeping.
+type TimeoutClock interface {
+	// start a timer that closes fired once d has elapsed on the clock.  stop
+	// releases the timer whether or not it fired.
+	StartTimer(d time.Duration) (fired <-chan struct{}, stop func())
+}
+
+// Go's timers, on CLOCK_MONOTONIC, which stops while the system is suspended
+var MonotonicClock TimeoutClock = monotonicClock{}
+
+type monotonicClock struct{}
+
+func (monotonicClock) StartTimer(d time.Duration) (<-chan struct{}, func()) {
+	fired := make(chan struct{})
+	timer := time.AfterFunc(d, func() { close(fired) })
+	return fired, func() { timer.Stop() }
+}
+
+// timerfds on CLOCK_BOOTTIME, which counts time suspended
+var BoottimeClock TimeoutClock = boottimeClock{}
+
+type boottimeClock struct{}
+
+func (boottimeClock) StartTimer(d time.Duration) (<-chan struct{}, func()) {
+	return startTimerfd(syscalls.NewTimerfd(unix.CLOCK_BOOTTIME, d))
+}
+
+// a timer firing when the timerfd expires, as TimeoutClock.StartTimer returns
+func startTimerfd(timer *syscalls.Timerfd, err error) (<-chan struct{}, func()) {
+	if err != nil {
+		panic(err)
+	}
+	fired := make(chan struct{})
+	go func() {
+		err := timer.Wait()
+		if err == nil {
+			close(fired)
+		} else if !errors.Is(err, os.ErrClosed) {
+			panic(err)
+		}
+	}()
+	return fired, func() {
+		if err := timer.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// parse a timeout clock name: boottime or monotonic.  Returns an *ExitError if
+// it is not a clock.
+func ParseTimeoutClock(s string) (TimeoutClock, error) {
+	switch s {
+	case "boottime":
+		return BoottimeClock, nil
+	case "monotonic":
+		return MonotonicClock, nil
+	}
+	return nil, &ExitError{
+		Message:      fmt.Sprintf("unknown timeout clock: %v", s),
+		ExitCode:     INPUT_ERROR,
+		DisplayUsage: true,
+		Cause:        nil}
+}
+
+// a context that ends once d has elapsed on clock, as context.WithTimeout
+// does on Go's clock.  Waiting then returns TimeoutErr.
+func WithClockTimeout(ctx context.Context, clock TimeoutClock,
+	d time.Duration) (context.Context, context.CancelFunc) {
+	fired, stop := clock.StartTimer(d)
+	return withTimer(ctx, fired, stop)
+}
+
+// an absolute time at which waiting times out, on the clock it was given on:
+// unix.CLOCK_REALTIME for wall clock times or unix.CLOCK_BOOTTIME for times
+// since boot
+type Deadline struct {
+	Clock int32
+	// since the clock's epoch
+	At time.Duration
+}
+
+// the time left until the deadline on its clock, zero or less once passed
+func (d Deadline) Remaining() time.Duration {
+	return d.At - proc.ClockTime(d.Clock)
+}
+
+// a context that ends once deadline's clock reaches it, as context.WithDeadline
+// does on Go's clock.  The timer is absolute so it follows changes to the clock,
+// such as setting the wall clock or suspending.  Waiting then returns
+// TimeoutErr.
+func WithDeadline(ctx context.Context,
+	deadline Deadline) (context.Context, context.CancelFunc) {
+	fired, stop := startTimerfd(
+		syscalls.NewTimerfdAt(int(deadline.Clock), deadline.At))
+	return withTimer(ctx, fired, stop)
+}
+
+// a context cancelled with context.DeadlineExceeded once fired closes.  The
+// timer is stopped when either happens.
+func withTimer(ctx context.Context, fired <-chan struct{},
+	stop func()) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		defer stop()
+		select {
+		case <-fired:
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
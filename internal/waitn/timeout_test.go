@@ -0,0 +1,74 @@
+package waitn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithClockTimeout(t *testing.T) {
+	require := require.New(t)
+
+	// times out on the clock, regardless of time passing otherwise
+	backend := newFakeBackend()
+	backend.spawn(3, 10)
+	ctx, cancel := WithClockTimeout(context.Background(), backend, 5)
+	defer cancel()
+	pidFiles, _, err := SetupPidFiles(backend, targetsOf(3), UNKNOWN_ERROR)
+	require.NoError(err)
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := WaitForPidFile(ctx, pidFiles)
+		errChan <- err
+	}()
+	backend.advance(4)
+	select {
+	case err := <-errChan:
+		require.FailNow("timed out early", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	backend.advance(5)
+	require.ErrorIs(<-errChan, TimeoutErr)
+
+	// processes exiting first are results
+	ctx, cancel = WithClockTimeout(context.Background(), backend, 5)
+	defer cancel()
+	pidFiles, _, err = SetupPidFiles(backend, targetsOf(3), UNKNOWN_ERROR)
+	require.NoError(err)
+	go func() {
+		_, err := WaitForPidFile(ctx, pidFiles)
+		errChan <- err
+	}()
+	backend.advance(10)
+	require.NoError(<-errChan)
+}
+
+func TestBoottimeClock(t *testing.T) {
+	require := require.New(t)
+
+	ctx, cancel := WithClockTimeout(context.Background(), BoottimeClock,
+		20*time.Millisecond)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		require.FailNow("timerfd did not fire")
+	}
+	require.Equal(TimeoutErr, contextExitError(ctx))
+
+	// cancelling first releases the timer
+	ctx, cancel = WithClockTimeout(context.Background(), BoottimeClock, time.Hour)
+	cancel()
+	<-ctx.Done()
+	require.Equal(TimeoutErr, contextExitError(ctx))
+
+	clock, err := ParseTimeoutClock("boottime")
+	require.NoError(err)
+	require.Equal(BoottimeClock, clock)
+	_, err = ParseTimeoutClock("sundial")
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	require.Equal(INPUT_ERROR, exitErr.ExitCode)
+}
@@ -0,0 +1,51 @@
+package waitn
+
+import (
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+)
+
+// when a process started and when waitn observed it exit.  Boot times are
+// since boot on CLOCK_BOOTTIME, and so comparable across suspend.
+type Timing struct {
+	// resolution is 1/proc.CLK_TCK
+	StartBoot time.Duration
+	Start     time.Time
+	ExitBoot  time.Duration
+	Exit      time.Time
+}
+
+// read the start times of the processes of started pid files, by pid.
+// Processes that already exited are omitted as their pids may have been reused
+// and /proc may describe another process.
+func StartTimings(pidFiles []PidFile) map[int]*Timing {
+	// wall clock time at boot, to convert boot times to wall clock
+	bootWall := time.Now().Add(-proc.BootTime())
+	timings := make(map[int]*Timing, len(pidFiles))
+	for _, pidFile := range pidFiles {
+		startBoot, err := proc.StartTime(pidFile.Pid())
+		if err != nil {
+			continue
+		}
+		// the pid file was not done after reading /proc, so what we read was
+		// for its process.
+		if done, err := pidFile.Done(); err != nil || done {
+			continue
+		}
+		timings[pidFile.Pid()] = &Timing{
+			StartBoot: startBoot,
+			Start:     bootWall.Add(startBoot)}
+	}
+	return timings
+}
+
+// record that the process's exit was observed now
+func (t *Timing) Exited() {
+	t.ExitBoot = proc.BootTime()
+	t.Exit = time.Now()
+}
+
+func (t *Timing) Elapsed() time.Duration {
+	return t.ExitBoot - t.StartBoot
+}
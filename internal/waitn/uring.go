@@ -0,0 +1,247 @@
+package waitn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// size of the io_uring submission queue.  Polls are submitted in batches of at
+// most this many.
+const uringEntries = 256
+
+// user data of io_uring completions.  Polls complete with their pid file's id,
+// counting from 1, and their removals with the id and uringRemove set.
+const (
+	uringStop   uint64 = 0
+	uringRemove uint64 = 1 << 63
+)
+
+// the backend polling pidfds with a single io_uring rather than registering
+// each with the runtime's epoll.  A one-shot IORING_OP_POLL_ADD is submitted
+// for each pidfd and a single goroutine reaps completions in batches, so that
+// WaitForPidFile need not start a goroutine for each pid.  Close once finished
+// using.
+type UringBackend struct {
+	ring *syscalls.Uring
+	mu   sync.Mutex
+	// ids of pid files, counting from 1
+	nextID uint64
+	files  map[uint64]*uringPidFile
+	// closed and replaced as completions are reaped and pid files closed,
+	// waking waiting pid files
+	changed chan struct{}
+	// closed once the reaping goroutine exits
+	done chan struct{}
+}
+
+// open an io_uring backend.  Returns an error satisfying
+// syscalls.ErrUringUnsupported if io_uring may not be used.
+func NewUringBackend() (*UringBackend, error) {
+	ring, err := syscalls.OpenUring(uringEntries)
+	if err != nil {
+		return nil, err
+	}
+	b := &UringBackend{
+		ring:    ring,
+		nextID:  1,
+		files:   make(map[uint64]*uringPidFile),
+		changed: make(chan struct{}),
+		done:    make(chan struct{})}
+	go b.reap()
+	return b, nil
+}
+
+func (b *UringBackend) reap() {
+	defer close(b.done)
+	for {
+		completions, err := b.ring.WaitCompletions()
+		if err != nil {
+			panic(err)
+		}
+		if b.complete(completions) {
+			return
+		}
+	}
+}
+
+// record completions against their pid files and wake waiters.  A poll that
+// fails records its error, which its pid file then returns, so that it does not
+// wait forever.  Returns whether the backend is stopping.
+func (b *UringBackend) complete(completions []syscalls.UringCompletion) bool {
+	stop := false
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, completion := range completions {
+		if completion.UserData == uringStop {
+			stop = true
+			continue
+		}
+		f, ok := b.files[completion.UserData]
+		if !ok {
+			continue
+		}
+		if completion.Res < 0 {
+			f.err = fmt.Errorf("io_uring poll of pid %v: %w", f.pid,
+				syscall.Errno(-completion.Res))
+		} else {
+			f.done = true
+		}
+	}
+	b.wakeLocked()
+	return stop
+}
+
+func (b *UringBackend) wakeLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *UringBackend) Open(pid int, thread bool) (PidFile, error) {
+	fd, err := syscalls.PidfdOpen(pid, thread, 0)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f := &uringPidFile{backend: b, id: b.nextID, pid: pid, fd: fd}
+	b.nextID++
+	if err := b.ring.PollAdd(fd, f.id); err != nil {
+		return nil, errors.Join(err, unix.Close(fd))
+	}
+	b.files[f.id] = f
+	return f, nil
+}
+
+// stop reaping and close the io_uring.  Pid files must be closed first, or not
+// used again, as when exiting.
+func (b *UringBackend) Close() error {
+	if err := b.ring.Nop(uringStop); err != nil {
+		return err
+	}
+	if err := b.ring.Submit(); err != nil {
+		return err
+	}
+	<-b.done
+	return b.ring.Close()
+}
+
+// the backend of pid files if they were all opened by the same
+// *UringBackend, otherwise nil
+func uringBackendOf(pidFiles []PidFile) *UringBackend {
+	var b *UringBackend
+	for _, pidFile := range pidFiles {
+		f, ok := pidFile.(*uringPidFile)
+		if !ok || (b != nil && f.backend != b) {
+			return nil
+		}
+		b = f.backend
+	}
+	return b
+}
+
+// block until the poll of any of pidFiles completes, without a goroutine for
+// each, or until the context ends.  If the context ends return an error as
+// WaitForPidFile does.
+func (b *UringBackend) waitForAny(ctx context.Context, pidFiles []PidFile) error {
+	if err := b.ring.Submit(); err != nil {
+		panic(err)
+	}
+	for {
+		b.mu.Lock()
+		changed := b.changed
+		for _, pidFile := range pidFiles {
+			if f := pidFile.(*uringPidFile); f.done || f.closed || f.err != nil {
+				b.mu.Unlock()
+				return nil
+			}
+		}
+		b.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return contextExitError(ctx)
+		}
+	}
+}
+
+// a pidfd polled by an io_uring
+type uringPidFile struct {
+	backend *UringBackend
+	id      uint64
+	pid     int
+	fd      int
+	// guarded by backend.mu
+	done   bool
+	closed bool
+	// the error of a failed poll
+	err error
+}
+
+func (f *uringPidFile) Pid() int {
+	return f.pid
+}
+
+func (f *uringPidFile) BlockUntilDoneOrClosed() error {
+	if err := f.backend.ring.Submit(); err != nil {
+		return err
+	}
+	for {
+		f.backend.mu.Lock()
+		done, closed, err, changed := f.done, f.closed, f.err, f.backend.changed
+		f.backend.mu.Unlock()
+		if closed {
+			return os.ErrClosed
+		} else if err != nil {
+			return err
+		} else if done {
+			return nil
+		}
+		<-changed
+	}
+}
+
+// the completion of the poll may not yet have been reaped, so the pidfd is
+// checked directly
+func (f *uringPidFile) Done() (bool, error) {
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	if f.closed {
+		return false, os.ErrClosed
+	} else if f.err != nil {
+		return false, f.err
+	}
+	return f.done || syscalls.IsReadable(f.fd), nil
+}
+
+func (f *uringPidFile) SendSignal(sig unix.Signal) error {
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return unix.PidfdSendSignal(f.fd, sig, nil, 0)
+}
+
+// the pending poll holds its own reference to the pidfd, so it is also removed.
+// The removal is submitted with the next batch, or when the backend closes.
+func (f *uringPidFile) Close() error {
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	delete(f.backend.files, f.id)
+	f.backend.wakeLocked()
+	if err := f.backend.ring.PollRemove(f.id, f.id|uringRemove); err != nil {
+		return err
+	}
+	return unix.Close(f.fd)
+}
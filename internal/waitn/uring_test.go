@@ -0,0 +1,152 @@
+package waitn
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func newTestUringBackend(tb testing.TB) *UringBackend {
+	backend, err := NewUringBackend()
+	if errors.Is(err, syscalls.ErrUringUnsupported) {
+		tb.Skip(err)
+	}
+	require.NoError(tb, err)
+	return backend
+}
+
+func TestUringBackend(t *testing.T) {
+	require := require.New(t)
+	backend := newTestUringBackend(t)
+	defer func() { require.NoError(backend.Close()) }()
+
+	running := exec.Command("sleep", "10")
+	require.NoError(running.Start())
+	defer running.Wait()
+	defer running.Process.Kill()
+	exits := exec.Command("sleep", "10")
+	require.NoError(exits.Start())
+	defer exits.Wait()
+
+	_, err := backend.Open(1<<30, false)
+	require.ErrorIs(err, unix.ESRCH)
+
+	pidFiles, result, err := SetupPidFiles(backend,
+		targetsOf(running.Process.Pid, exits.Process.Pid), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.Zero(result)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = WaitForPidFile(ctx, pidFiles)
+	require.ErrorIs(err, TimeoutErr)
+	_, err = pidFiles[0].Done()
+	require.ErrorIs(err, os.ErrClosed)
+
+	pidFiles, _, err = SetupPidFiles(backend,
+		targetsOf(running.Process.Pid, exits.Process.Pid), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.NoError(pidFiles[1].SendSignal(syscall.SIGTERM))
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err = WaitForPidFile(ctx, pidFiles)
+	require.NoError(err)
+	require.Equal(ResultPid(exits.Process.Pid), result.Pid)
+
+	// streaming waits on each pid file
+	pidFiles, _, err = SetupAllPidFiles(backend,
+		targetsOf(exits.Process.Pid, exits.Process.Pid))
+	require.NoError(err)
+	var results []ResultPid
+	require.NoError(StreamPidFiles(context.Background(), pidFiles,
+		func(result Result) { results = append(results, result.Pid) }))
+	require.Len(results, 2)
+}
+
+func TestUringFailedPoll(t *testing.T) {
+	require := require.New(t)
+	backend := newTestUringBackend(t)
+	defer func() { require.NoError(backend.Close()) }()
+
+	running := exec.Command("sleep", "10")
+	require.NoError(running.Start())
+	defer running.Wait()
+	defer running.Process.Kill()
+
+	pidFile, err := backend.Open(running.Process.Pid, false)
+	require.NoError(err)
+	defer pidFile.Close()
+	blocked := make(chan error, 1)
+	go func() { blocked <- pidFile.BlockUntilDoneOrClosed() }()
+
+	// as if the poll of the pidfd failed
+	backend.complete([]syscalls.UringCompletion{{
+		UserData: pidFile.(*uringPidFile).id,
+		Res:      -int32(unix.EINVAL)}})
+	select {
+	case err := <-blocked:
+		require.ErrorIs(err, unix.EINVAL)
+	case <-time.After(5 * time.Second):
+		require.Fail("still blocked after the poll failed")
+	}
+	_, err = pidFile.Done()
+	require.ErrorIs(err, unix.EINVAL)
+}
+
+// waiting for many processes, one of which exits once waiting has started.  Pid
+// files are opened for the same running process as many processes are not
+// needed to measure the cost of waiting.
+func BenchmarkWaitForPidFile(b *testing.B) {
+	running := exec.Command("sleep", "1000")
+	require.NoError(b, running.Start())
+	defer running.Wait()
+	defer running.Process.Kill()
+
+	backends := map[string]func(*testing.B) Backend{
+		"pidfd": func(*testing.B) Backend { return PidfdBackend },
+		"uring": func(b *testing.B) Backend { return newTestUringBackend(b) },
+	}
+	for name, newBackend := range backends {
+		for _, n := range []int{10, 1000} {
+			b.Run(name+"/"+strconv.Itoa(n), func(b *testing.B) {
+				benchmarkWaitForPidFile(b, newBackend(b), running.Process.Pid, n)
+			})
+		}
+	}
+}
+
+func benchmarkWaitForPidFile(b *testing.B, backend Backend, pid int, n int) {
+	if closer, ok := backend.(*UringBackend); ok {
+		defer closer.Close()
+	}
+	targets := targetsOf(pid)
+	for len(targets) < n-1 {
+		targets = append(targets, targets[0])
+	}
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		exits := exec.Command("sleep", "1000")
+		require.NoError(b, exits.Start())
+		b.StartTimer()
+
+		pidFiles, _, err := SetupPidFiles(backend,
+			append(targets, Target{Pid: exits.Process.Pid}), UNKNOWN_ERROR)
+		require.NoError(b, err)
+		go exits.Process.Kill()
+		result, err := WaitForPidFile(context.Background(), pidFiles)
+		require.NoError(b, err)
+		require.Equal(b, ResultPid(exits.Process.Pid), result.Pid)
+
+		b.StopTimer()
+		exits.Wait()
+		b.StartTimer()
+	}
+}
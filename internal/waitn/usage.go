@@ -0,0 +1,79 @@
+package waitn
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/proc"
+)
+
+// samples the usage of processes that are not our children from /proc while
+// they are alive.  /proc no longer describes a process once it is reaped, so
+// the last sample is the best available once it exits.
+type UsageSampler struct {
+	mu   sync.Mutex
+	last map[int]proc.Usage
+	stop chan struct{}
+	done chan struct{}
+}
+
+// sample the processes of started pid files now and then every interval until
+// Stop.  A process is no longer sampled once it exits or its pid file is
+// closed.
+func SampleUsage(pidFiles []PidFile,
+	interval time.Duration) *UsageSampler {
+	s := &UsageSampler{
+		last: make(map[int]proc.Usage, len(pidFiles)),
+		stop: make(chan struct{}),
+		done: make(chan struct{})}
+	live := s.sample(append([]PidFile(nil), pidFiles...))
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for len(live) > 0 {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				live = s.sample(live)
+			}
+		}
+	}()
+	return s
+}
+
+// sample each process, returning those still alive
+func (s *UsageSampler) sample(pidFiles []PidFile) []PidFile {
+	live := pidFiles[:0]
+	for _, pidFile := range pidFiles {
+		usage, err := proc.ReadUsage(pidFile.Pid())
+		if err != nil {
+			continue
+		}
+		// as in StartTimings, the sample is only known to be of the process if
+		// it had not exited after reading /proc.
+		if done, err := pidFile.Done(); err != nil || done {
+			continue
+		}
+		s.mu.Lock()
+		s.last[pidFile.Pid()] = usage
+		s.mu.Unlock()
+		live = append(live, pidFile)
+	}
+	return live
+}
+
+// the last sampled usage of the process, false if it was never sampled
+func (s *UsageSampler) Last(pid int) (proc.Usage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage, ok := s.last[pid]
+	return usage, ok
+}
+
+// stop sampling and wait for any sample in progress to finish
+func (s *UsageSampler) Stop() {
+	close(s.stop)
+	<-s.done
+}
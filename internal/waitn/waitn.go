@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/stevenpelley/waitn/internal/syscalls"
 	"golang.org/x/sys/unix"
@@ -16,12 +19,18 @@ const (
 	PROCESS_TERMINATED      = 0
 	PROCESS_NOT_FOUND_ERROR = 1
 	TIMEOUT_ERROR           = 2
+	JOB_FAILED_ERROR        = 3
+	DEADLINE_PASSED_ERROR   = 4
 	INPUT_ERROR             = 127
 )
 
 // error strings
 const (
-	PID_PARSE_ERR = "pid is not a valid number"
+	PID_PARSE_ERR      = "pid is not a valid number"
+	LABEL_PARSE_ERR    = "label must be non-empty and contain no whitespace"
+	LABEL_COUNT_ERR    = "more labels than pids"
+	LABEL_CONFLICT_ERR = "pid labelled both by -label and as <label>=<pid>"
+	DUPLICATE_PID_ERR  = "pid given more than once with different labels"
 )
 
 type ExitError struct {
@@ -48,90 +57,325 @@ var ProcessNotFoundErr *ExitError = &ExitError{
 	DisplayUsage: false,
 	Cause:        nil}
 
+var JobFailedErr *ExitError = &ExitError{
+	Message:      "",
+	ExitCode:     JOB_FAILED_ERROR,
+	DisplayUsage: false,
+	Cause:        nil}
+
 var TimeoutErr *ExitError = &ExitError{
 	Message:      "timed out",
 	ExitCode:     TIMEOUT_ERROR,
 	DisplayUsage: false,
 	Cause:        nil}
 
+var DeadlinePassedErr *ExitError = &ExitError{
+	Message:      "deadline passed",
+	ExitCode:     DEADLINE_PASSED_ERROR,
+	DisplayUsage: false,
+	Cause:        nil}
+
+// exit code base for being interrupted by a signal.  As in shells, the exit
+// code is this plus the signal number.
+const SIGNAL_EXIT_BASE = 128
+
+// error for waiting interrupted by a signal.  Cancel the waiting context with
+// this as its cause to exit with the signal's exit code.
+func SignalErr(sig syscall.Signal) *ExitError {
+	return &ExitError{
+		Message:      "",
+		ExitCode:     SIGNAL_EXIT_BASE + int(sig),
+		DisplayUsage: false,
+		Cause:        nil}
+}
+
+// the error to return when the waiting context ends.  This is the context's
+// cause if it is an *ExitError, otherwise TimeoutErr.
+func contextExitError(ctx context.Context) error {
+	var exitErr *ExitError
+	if errors.As(context.Cause(ctx), &exitErr) {
+		return exitErr
+	}
+	return TimeoutErr
+}
+
+// send sig to every process with an open pid file.  Processes that have
+// already terminated and pid files closed because waiting finished are
+// ignored.
+func SignalPidFiles(pidFiles []PidFile, sig syscall.Signal) error {
+	var errs []error
+	for _, pidFile := range pidFiles {
+		err := pidFile.SendSignal(sig)
+		if err != nil && !errors.Is(err, unix.ESRCH) &&
+			!errors.Is(err, os.ErrClosed) {
+			errs = append(errs, fmt.Errorf("signal pid %v: %w", pidFile.Pid(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // cannot be 0, so 0 means no result
 type ResultPid int
 
+// a pid reported as a result along with what waitn saw of its process when it
+// found it finished or not found.  The zero Result is no result.
+type Result struct {
+	Pid   ResultPid
+	State ProcessState
+	// no pid file could be opened for the process, so it was not waited for
+	NotFound bool
+}
+
+// a pid to wait for along with an optional label naming it.  Label is empty
+// if none was provided.
+type Target struct {
+	Pid   int
+	Label string
+	// Pid is a thread id, waiting for only that thread to exit
+	Thread bool
+	// with -pidns, the target's pid in that namespace.  Pid is its pid in our
+	// namespace, or 0 if no process in the namespace has it.  0 otherwise.
+	NsPid int
+}
+
+// the pid reporting this target as a result.  Targets not found in their
+// namespace are reported by their namespace pid.
+func (target Target) resultPid() ResultPid {
+	if target.Pid == 0 {
+		return ResultPid(target.NsPid)
+	}
+	return ResultPid(target.Pid)
+}
+
+// parse command line arguments into targets.  Each argument is either a pid or
+// label=pid.  The ith of labels labels the ith argument, which must then be a
+// bare pid.  Returns an *ExitError if any argument or label cannot be parsed,
+// there are more labels than arguments, or a pid is given more than once with
+// different labels.
+func ParseTargets(args []string, labels []string) ([]Target, error) {
+	inputErr := func(message string, cause error) error {
+		return &ExitError{
+			Message:      message,
+			ExitCode:     INPUT_ERROR,
+			DisplayUsage: true,
+			Cause:        cause}
+	}
+	if len(labels) > len(args) {
+		return nil, inputErr(LABEL_COUNT_ERR, nil)
+	}
+	targets := make([]Target, len(args))
+	labelsByPid := make(map[int]string)
+	for i, arg := range args {
+		var label string
+		labelled := false
+		pidStr := arg
+		if idx := strings.LastIndex(arg, "="); idx != -1 {
+			if i < len(labels) {
+				return nil, inputErr(LABEL_CONFLICT_ERR, nil)
+			}
+			label = arg[:idx]
+			pidStr = arg[idx+1:]
+			labelled = true
+		} else if i < len(labels) {
+			label = labels[i]
+			labelled = true
+		}
+		if labelled && (len(label) == 0 || strings.ContainsAny(label, " \t\n")) {
+			return nil, inputErr(LABEL_PARSE_ERR, nil)
+		}
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil {
+			return nil, inputErr(PID_PARSE_ERR, err)
+		}
+		// results are reported by pid and so could name only one of its labels
+		if other, ok := labelsByPid[pid]; ok && other != label {
+			return nil, inputErr(DUPLICATE_PID_ERR, nil)
+		}
+		labelsByPid[pid] = label
+		targets[i] = Target{Pid: pid, Label: label}
+	}
+	return targets, nil
+}
+
+// returns the first target reported by the provided pid, and false if there is
+// no such target.
+func TargetOf(targets []Target, pid ResultPid) (Target, bool) {
+	for _, target := range targets {
+		if target.resultPid() == pid {
+			return target, true
+		}
+	}
+	return Target{}, false
+}
+
 // Set up all the pid files, or determine that we are done.
 // Returns at least one of:
 // list of pid files -- continue to poll the pid files if not nil
-// resultPid -- failed to find a process, treat it as completed.  0 is none
-// exitError -- an error that will end the program.  May contain an *exitError
+// result -- failed to find a process, treat it as completed, with a State of
+// PROCESS_GONE or PROCESS_INVISIBLE.  The zero Result is none
+// exitError -- an error that will end the program.  May contain an *exitError,
+// ProcessNotFoundErr if policy makes the pid not found an error
 //
-// may not return a non-nil list of pid files alongside a non-zero resultPid or
+// may not return a non-nil list of pid files alongside a non-zero result or
 // error.
-func SetupPidFiles(args []string, errorOnUnknown bool) ([]*syscalls.PidFile, ResultPid, error) {
-	pids := make([]int, len(args))
-	for i, arg := range args {
-		var pid int
-		pid, err := strconv.Atoi(arg)
-		if err != nil {
-			exitErr := &ExitError{
-				Message:      PID_PARSE_ERR,
-				ExitCode:     INPUT_ERROR,
-				DisplayUsage: true,
-				Cause:        err}
-			return nil, 0, exitErr
-		}
-		pids[i] = pid
+func SetupPidFiles(backend Backend, targets []Target, policy UnknownPolicy) (
+	[]PidFile, Result, error) {
+	pidFiles, notFound, err := openPidFiles(backend, targets, true)
+	if err != nil {
+		return nil, Result{}, err
 	}
+	if len(notFound) > 0 {
+		return nil, notFound[0], UnknownPidsErr(policy, notFound)
+	}
+	return pidFiles, Result{}, nil
+}
+
+// Set up pid files for all targets that can be found, as for streaming every
+// target.  Returns the pid files of found processes and, in argument order, the
+// results of all processes that could not be found, whose State says why.
+// Either may be empty.  Returns an *ExitError if a target cannot be waited for.
+func SetupAllPidFiles(backend Backend, targets []Target) (
+	[]PidFile, []Result, error) {
+	return openPidFiles(backend, targets, false)
+}
 
-	pidFiles := make([]*syscalls.PidFile, len(pids))
+// open a pid file for each target using backend, returning results for targets
+// without a process.  If stopOnNotFound then return after the first target
+// without a process, closing all pid files.  Returns an
+// *ExitError, closing all pid files, if a thread target cannot be opened
+// because the kernel does not support it, a non-thread target is a thread id,
+// or the backend runs out of file descriptors.
+func openPidFiles(backend Backend, targets []Target, stopOnNotFound bool) (
+	[]PidFile, []Result, error) {
+	pidFiles := make([]PidFile, 0, len(targets))
+	var notFound []Result
 	doDefer := true
 	defer func() {
 		if !doDefer {
 			return
 		}
 		for _, pidFile := range pidFiles {
-			if pidFile == nil {
-				continue
-			}
 			if err := pidFile.Close(); err != nil {
 				panic(err)
 			}
 		}
 	}()
-	for i, pid := range pids {
-		pidFile := &syscalls.PidFile{Pid: pid}
-		err := pidFile.Start()
-		if errors.Is(err, unix.ESRCH) {
-			retPid := ResultPid(pid)
-			exitErr := exitErrorUnknownProcess(errorOnUnknown)
-			return nil, retPid, exitErr
+	for _, target := range targets {
+		var pidFile PidFile
+		var err error
+		if target.Pid == 0 {
+			err = unix.ESRCH
+		} else {
+			pidFile, err = backend.Open(target.Pid, target.Thread)
+		}
+		// a translated pid may have been reused by another process before
+		// opening the pid file
+		if err == nil && target.NsPid != 0 && !hasNsPid(target) {
+			if err := pidFile.Close(); err != nil {
+				panic(err)
+			}
+			err = unix.ESRCH
+		}
+		if errors.Is(err, unix.ESRCH) || errors.Is(err, ErrInvisible) {
+			notFound = append(notFound, Result{Pid: target.resultPid(),
+				State: unknownState(target, err), NotFound: true})
+			if stopOnNotFound {
+				return nil, notFound, nil
+			}
+			continue
+		} else if errors.Is(err, syscalls.ErrThreadUnsupported) ||
+			errors.Is(err, syscalls.ErrNotThreadGroupLeader) {
+			return nil, nil, &ExitError{
+				Message:      fmt.Sprintf("pid %v", target.Pid),
+				ExitCode:     INPUT_ERROR,
+				DisplayUsage: false,
+				Cause:        err}
+		} else if errors.Is(err, unix.EMFILE) || errors.Is(err, unix.ENFILE) {
+			return nil, nil, &ExitError{
+				Message: fmt.Sprintf(
+					"pid %v: more pids than the limit on open files", target.Pid),
+				ExitCode:     INPUT_ERROR,
+				DisplayUsage: false,
+				Cause:        err}
 		} else if err != nil {
 			panic(err)
 		}
-		pidFiles[i] = pidFile
+		pidFiles = append(pidFiles, pidFile)
 	}
 
 	// We set up all pid files without error.  Disable the deferred close.
 	// Caller takes responsibility for closing the files.
 	doDefer = false
+	return pidFiles, notFound, nil
+}
 
-	// pidFiles is set, retPid and err are 0/nil
-	return pidFiles, 0, nil
+// Set up a pid file for the parent of this process using backend, as a portable
+// alternative to PR_SET_PDEATHSIG.  Returns either a pid file to wait on or, if
+// the parent has already exited, the parent's result.
+//
+// The parent may exit between reading its pid and opening the pid file, in
+// which case this process is reparented and the pid may even be reused.  The
+// parent pid is read again after opening to detect this.  A parent that exited
+// before this process first read it cannot be detected; the new parent (e.g.,
+// init or a subreaper) is used.
+func SetupParentPidFile(backend Backend) (PidFile, Result) {
+	ppid := os.Getppid()
+	pidFile, err := backend.Open(ppid, false)
+	if errors.Is(err, unix.ESRCH) {
+		return nil, Result{Pid: ResultPid(ppid), State: PROCESS_GONE,
+			NotFound: true}
+	} else if err != nil {
+		panic(err)
+	}
+	if os.Getppid() != ppid {
+		if err := pidFile.Close(); err != nil {
+			panic(err)
+		}
+		return nil, exitedResult(ResultPid(ppid))
+	}
+	return pidFile, Result{}
 }
 
-func exitErrorUnknownProcess(errorOnUnknown bool) error {
-	if !errorOnUnknown {
-		return nil
+// the results of the processes of pid files that have already exited, in
+// order, without blocking.  Close all pid files before returning.
+func PollPidFiles(pidFiles []PidFile) []Result {
+	ready := scanReady(pidFiles)
+	for _, pidFile := range pidFiles {
+		if err := pidFile.Close(); err != nil {
+			panic(err)
+		}
 	}
-	// this error simply changes the exit code while still providing a result
-	return ProcessNotFoundErr
+	return ready
 }
 
 // wait for the first pid file to finish or for the context to end.  Close all
-// resources and return either a non-zero resultPid or non-nil exitError
-func WaitForPidFile(ctx context.Context, pidFiles []*syscalls.PidFile) (
-	ResultPid, error) {
+// resources and return either a non-zero Result or non-nil exitError.  If
+// several processes have finished the first in argument order is returned, as
+// in WaitForReady.  If the context ends the error is its cause if that is an
+// *ExitError, otherwise TimeoutErr.
+func WaitForPidFile(ctx context.Context, pidFiles []PidFile) (
+	Result, error) {
 	if pidFiles == nil {
 		panic("WaitForPidFile: pidFiles is nil")
 	}
+	ready, exErr := WaitForReady(ctx, pidFiles)
+	if exErr != nil {
+		return Result{}, exErr
+	}
+	return ready[0], nil
+}
+
+// wait for any pid file to finish or for the context to end.  Close all
+// resources and return either the results of every process found finished, in
+// argument order, or non-nil exitError.  Once any process finishes all are
+// checked in a single scan, so which pids are returned does not depend on the
+// order in which waiting goroutines are woken.  If the context ends the error
+// is its cause if that is an *ExitError, otherwise TimeoutErr.
+func WaitForReady(ctx context.Context, pidFiles []PidFile) (
+	[]Result, error) {
+	if pidFiles == nil {
+		panic("WaitForReady: pidFiles is nil")
+	}
 
 	// close files to unblock all waiting goroutines.  We'll do this after
 	// receiving a pid or on a timeout.  We also defer this so that we'll
@@ -145,13 +389,26 @@ func WaitForPidFile(ctx context.Context, pidFiles []*syscalls.PidFile) (
 	})
 	defer closePidFilesOnce()
 
+	// processes that finished before waiting need no goroutines
+	if ready := scanReady(pidFiles); len(ready) > 0 {
+		return ready, nil
+	}
+
+	// the io_uring backend waits for all pid files at once
+	if b := uringBackendOf(pidFiles); b != nil {
+		if exErr := b.waitForAny(ctx, pidFiles); exErr != nil {
+			return nil, exErr
+		}
+		return scanReady(pidFiles), nil
+	}
+
 	// channel is buffered size 1.  pidfile goroutines attempt to write
 	// nonblocking.  Guaranteed to write the first result.  If anyone else
 	// managed to write it will be ignored.
 	// on error we'll panic from the main goroutine, which should make it easier
 	// to handle gracefully in the future should we choose to.
 	type pidFileResult struct {
-		pidFile *syscalls.PidFile
+		pidFile PidFile
 		err     error
 	}
 	c := make(chan pidFileResult, 1)
@@ -172,20 +429,94 @@ func WaitForPidFile(ctx context.Context, pidFiles []*syscalls.PidFile) (
 	}
 
 	// wait for the first process to finish or a timeout
-	var pid ResultPid
+	var ready []Result
 	var exErr error
 	select {
 	case result := <-c:
-		pid = ResultPid(result.pidFile.Pid)
 		if result.err != nil {
-			panic(fmt.Sprintf("error on PidFile %v: %v", pid, result.err))
+			panic(fmt.Sprintf("error on PidFile %v: %v", result.pidFile.Pid(), result.err))
 		}
+		// includes the result's process, and any that finished since
+		ready = scanReady(pidFiles)
 	case <-ctx.Done():
-		exErr = TimeoutErr
+		exErr = contextExitError(ctx)
 	}
 
 	// unblock all pidfile goroutines and join them.
 	closePidFilesOnce()
 	wg.Wait()
-	return pid, exErr
+	return ready, exErr
+}
+
+// the results of the processes of open pid files that have finished, in order.
+// Each is classified as it is found, while its pid file is open.
+func scanReady(pidFiles []PidFile) []Result {
+	var ready []Result
+	for _, pidFile := range pidFiles {
+		done, err := pidFile.Done()
+		if err != nil {
+			panic(fmt.Sprintf("error on PidFile %v: %v", pidFile.Pid(), err))
+		}
+		if done {
+			ready = append(ready, exitedResult(ResultPid(pidFile.Pid())))
+		}
+	}
+	return ready
+}
+
+// wait for every pid file to finish or for the context to end, calling onResult
+// with each result in the order its process completes.  Close all resources and
+// return nil if all processes completed.  If the context ends return an error as
+// WaitForPidFile does.
+func StreamPidFiles(ctx context.Context, pidFiles []PidFile,
+	onResult func(Result)) error {
+	if pidFiles == nil {
+		panic("StreamPidFiles: pidFiles is nil")
+	}
+
+	closePidFilesOnce := sync.OnceFunc(func() {
+		for _, pidFile := range pidFiles {
+			if err := pidFile.Close(); err != nil {
+				panic(err)
+			}
+		}
+	})
+	defer closePidFilesOnce()
+
+	// channel is buffered to hold every result so that no goroutine blocks
+	// after a timeout.
+	type pidFileResult struct {
+		pidFile PidFile
+		err     error
+	}
+	c := make(chan pidFileResult, len(pidFiles))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(pidFiles))
+	for _, pidFile := range pidFiles {
+		pidFile := pidFile
+		go func() {
+			err := pidFile.BlockUntilDoneOrClosed()
+			c <- pidFileResult{pidFile: pidFile, err: err}
+			wg.Done()
+		}()
+	}
+
+	var exErr error
+	for remaining := len(pidFiles); remaining > 0 && exErr == nil; remaining-- {
+		select {
+		case result := <-c:
+			pid := ResultPid(result.pidFile.Pid())
+			if result.err != nil {
+				panic(fmt.Sprintf("error on PidFile %v: %v", pid, result.err))
+			}
+			onResult(exitedResult(pid))
+		case <-ctx.Done():
+			exErr = contextExitError(ctx)
+		}
+	}
+
+	closePidFilesOnce()
+	wg.Wait()
+	return exErr
 }
@@ -2,27 +2,28 @@ package waitn
 
 import (
 	"context"
-	"math/rand"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"strconv"
-	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"github.com/stevenpelley/waitn/internal/testutil"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
-func TestSetupPidFiles(t *testing.T) {
+func TestParseTargets(t *testing.T) {
 	require := require.New(t)
 
 	// error parsing
 	{
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{"asdf"}, false)
-		require.Nil(pidFiles)
-		require.EqualValues(0, retPid)
+		targets, err := ParseTargets([]string{"asdf"}, nil)
+		require.Nil(targets)
 		var exitErr *ExitError
 		require.ErrorAs(err, &exitErr)
 		require.Equal(INPUT_ERROR, exitErr.ExitCode)
@@ -30,64 +31,139 @@ func TestSetupPidFiles(t *testing.T) {
 		require.ErrorIs(exitErr, strconv.ErrSyntax)
 	}
 
-	// pid not found, success
+	// bad labels
+	for _, arg := range []string{"=123", "a b=123", "name=", "name=x"} {
+		targets, err := ParseTargets([]string{arg}, nil)
+		require.Nil(targets, arg)
+		var exitErr *ExitError
+		require.ErrorAs(err, &exitErr, arg)
+		require.Equal(INPUT_ERROR, exitErr.ExitCode, arg)
+	}
+
+	// pids and labels
+	{
+		targets, err := ParseTargets([]string{"123", "name=456", "a=b=789"}, nil)
+		require.NoError(err)
+		require.Equal([]Target{
+			{Pid: 123},
+			{Pid: 456, Label: "name"},
+			{Pid: 789, Label: "a=b"}}, targets)
+	}
+
+	// -label labels pids in order
+	{
+		targets, err := ParseTargets(
+			[]string{"123", "456", "c=789"}, []string{"a", "b"})
+		require.NoError(err)
+		require.Equal([]Target{
+			{Pid: 123, Label: "a"},
+			{Pid: 456, Label: "b"},
+			{Pid: 789, Label: "c"}}, targets)
+	}
+
+	// a pid may repeat only with the same label
+	{
+		targets, err := ParseTargets([]string{"a=5", "a=5", "6", "6"}, nil)
+		require.NoError(err)
+		require.Len(targets, 4)
+	}
 
-	// find a pid with no process
-	var pid int
-	var pidStr string
-	{
-		bytes, err := os.ReadFile("/proc/sys/kernel/pid_max")
-		require.NoError(err)
-		maxPid, err := strconv.Atoi(strings.TrimSpace(string(bytes)))
-		require.NoError(err)
-		for {
-			pid = rand.Intn(maxPid - 1)
-			pid += 1
-			proc, err := os.FindProcess(pid)
-			// always returns a process for unix
-			require.NoError(err)
-			err = proc.Signal(syscall.Signal(0))
-			if err != nil {
-				// no process exists
-				break
-			}
-		}
-		pidStr = strconv.Itoa(pid)
-
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{pidStr}, false)
+	for _, c := range []struct {
+		args    []string
+		labels  []string
+		message string
+	}{
+		{[]string{"123"}, []string{"a", "b"}, LABEL_COUNT_ERR},
+		{[]string{"a=123"}, []string{"b"}, LABEL_CONFLICT_ERR},
+		{[]string{"123"}, []string{"a b"}, LABEL_PARSE_ERR},
+		{[]string{"a=5", "b=5"}, nil, DUPLICATE_PID_ERR},
+		{[]string{"5", "b=5"}, nil, DUPLICATE_PID_ERR},
+		{[]string{"5", "5"}, []string{"a", "b"}, DUPLICATE_PID_ERR},
+	} {
+		targets, err := ParseTargets(c.args, c.labels)
+		require.Nil(targets, c.args)
+		var exitErr *ExitError
+		require.ErrorAs(err, &exitErr, c.args)
+		require.Equal(INPUT_ERROR, exitErr.ExitCode, c.args)
+		require.Equal(c.message, exitErr.Message, c.args)
+	}
+}
+
+func TestSetupPidFiles(t *testing.T) {
+	require := require.New(t)
+	backend := newFakeBackend()
+	backend.spawn(3, fakeNever)
+	backend.spawn(4, fakeNever)
+
+	// pid not found, success
+	{
+		pidFiles, result, err := SetupPidFiles(backend, targetsOf(3, 5, 6), UNKNOWN_OK)
 		require.Nil(pidFiles)
-		require.EqualValues(pid, retPid)
+		require.EqualValues(5, result.Pid)
 		require.NoError(err)
 	}
 
 	// pid not found, error
 	{
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{pidStr}, true)
+		pidFiles, result, err := SetupPidFiles(backend, targetsOf(3, 5, 6), UNKNOWN_ERROR)
 		require.Nil(pidFiles)
-		require.EqualValues(pid, retPid)
+		require.EqualValues(5, result.Pid)
 		require.ErrorIs(err, ProcessNotFoundErr)
 	}
 
-	// pid found
+	// pids found
 	{
-		ctx, cancelFunc := context.WithCancel(context.Background())
-		defer cancelFunc()
-		cmd, err := createTestSleep(ctx, "10")
+		pidFiles, result, err := SetupPidFiles(backend, targetsOf(3, 4), UNKNOWN_ERROR)
 		require.NoError(err)
-		pid := cmd.Process.Pid
+		require.EqualValues(0, result.Pid)
+		require.Len(pidFiles, 2)
+		require.Equal(3, pidFiles[0].Pid())
+		require.Equal(4, pidFiles[1].Pid())
+	}
+
+	// all pids, in argument order
+	{
+		pidFiles, notFound, err := SetupAllPidFiles(backend, targetsOf(6, 3, 5, 4))
+		require.NoError(err)
+		require.Equal([]ResultPid{6, 5}, pidsOf(notFound))
+		require.Len(pidFiles, 2)
+		require.Equal(3, pidFiles[0].Pid())
+		require.Equal(4, pidFiles[1].Pid())
+	}
+}
+
+func TestSetupPidFilesErrors(t *testing.T) {
+	require := require.New(t)
+	backend := newFakeBackend()
+	backend.spawn(3, fakeNever)
+	backend.failOpen(4, fmt.Errorf("%w: %w",
+		syscalls.ErrNotThreadGroupLeader, unix.EINVAL))
+	backend.failOpen(5, unix.ESRCH)
+	backend.failOpen(6, unix.EPERM)
+
+	// not a process
+	{
+		pidFiles, result, err := SetupPidFiles(backend, targetsOf(3, 4), UNKNOWN_ERROR)
+		require.Nil(pidFiles)
+		require.Zero(result)
+		var exitErr *ExitError
+		require.ErrorAs(err, &exitErr)
+		require.Equal(INPUT_ERROR, exitErr.ExitCode)
+		require.ErrorIs(err, syscalls.ErrNotThreadGroupLeader)
+	}
 
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{strconv.Itoa(pid)}, true)
+	// exited while opening
+	{
+		pidFiles, notFound, err := SetupAllPidFiles(backend, targetsOf(3, 5))
 		require.NoError(err)
-		require.EqualValues(0, retPid)
+		require.Equal([]ResultPid{5}, pidsOf(notFound))
 		require.Len(pidFiles, 1)
-		pidFile := pidFiles[0]
-		require.Equal(pid, pidFile.Pid)
-		cancelFunc()
-		cmd.Wait()
 	}
+
+	// unexpected errors panic
+	require.Panics(func() {
+		SetupPidFiles(backend, targetsOf(3, 6), UNKNOWN_ERROR)
+	})
 }
 
 func TestWaitForPidFile(t *testing.T) {
@@ -95,74 +171,246 @@ func TestWaitForPidFile(t *testing.T) {
 
 	// timeout
 	{
-		procCtx, cancelProc := context.WithCancel(context.Background())
-		defer cancelProc()
-		cmd, err := createTestSleep(procCtx, "10")
+		backend := newFakeBackend()
+		backend.spawn(3, fakeNever)
+		pidFiles, _, err := SetupPidFiles(backend, targetsOf(3), UNKNOWN_ERROR)
 		require.NoError(err)
-		pid := cmd.Process.Pid
 
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{strconv.Itoa(pid)}, true)
-		require.NoError(err)
-		require.EqualValues(0, retPid)
-		require.Len(pidFiles, 1)
-
-		waitCtx, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
-		defer cancelTimeout()
-		retPid, err = WaitForPidFile(waitCtx, pidFiles)
+		waitCtx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := WaitForPidFile(waitCtx, pidFiles)
 		require.ErrorIs(err, TimeoutErr)
-		require.EqualValues(0, retPid)
-		cancelProc()
+		require.EqualValues(0, result.Pid)
+		_, err = pidFiles[0].Done()
+		require.ErrorIs(err, os.ErrClosed)
 	}
 
-	// single pid, completes
+	// first to exit while waiting
 	{
-		var err error
-		procCtx := context.Background()
-		cmd, err := createTestSleep(procCtx, "0.1")
-		require.NoError(err)
-		pid := cmd.Process.Pid
-
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{strconv.Itoa(pid)}, true)
+		backend := newFakeBackend()
+		backend.spawn(3, 5)
+		backend.spawn(4, 10)
+		pidFiles, _, err := SetupPidFiles(backend, targetsOf(4, 3), UNKNOWN_ERROR)
 		require.NoError(err)
-		require.EqualValues(0, retPid)
-		require.Len(pidFiles, 1)
 
-		waitCtx, cancelTimeout := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancelTimeout()
-		retPid, err = WaitForPidFile(waitCtx, pidFiles)
+		go backend.advance(5)
+		result, err := WaitForPidFile(context.Background(), pidFiles)
 		require.NoError(err)
-		require.EqualValues(cmd.Process.Pid, retPid)
+		require.EqualValues(3, result.Pid)
 	}
 
-	// multiple pid, completes
+	// simultaneous exits while waiting: the earliest argument wins
 	{
-		var err error
-		procCtx := context.Background()
-		cmd1, err := createTestSleep(procCtx, "0.1")
+		backend := newFakeBackend()
+		backend.spawn(3, 5)
+		backend.spawn(4, 5)
+		backend.spawn(5, 10)
+		pidFiles, _, err := SetupPidFiles(backend, targetsOf(5, 4, 3), UNKNOWN_ERROR)
 		require.NoError(err)
-		pid1 := cmd1.Process.Pid
-		cmd2, err := createTestSleep(procCtx, "2.0")
+
+		go backend.advance(5)
+		result, err := WaitForPidFile(context.Background(), pidFiles)
 		require.NoError(err)
-		pid2 := cmd2.Process.Pid
+		require.EqualValues(4, result.Pid)
+	}
 
-		pidFiles, retPid, err := SetupPidFiles(
-			[]string{strconv.Itoa(pid1), strconv.Itoa(pid2)}, true)
+	// an error reading a pid file panics
+	{
+		backend := newFakeBackend()
+		backend.spawn(3, fakeNever)
+		backend.failRead(3, 5, unix.EIO)
+		pidFiles, _, err := SetupPidFiles(backend, targetsOf(3), UNKNOWN_ERROR)
 		require.NoError(err)
-		require.EqualValues(0, retPid)
-		require.Len(pidFiles, 2)
 
-		waitCtx, cancelTimeout := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancelTimeout()
-		retPid, err = WaitForPidFile(waitCtx, pidFiles)
+		go backend.advance(5)
+		require.Panics(func() {
+			WaitForPidFile(context.Background(), pidFiles)
+		})
+	}
+}
+
+func TestWaitForPidFileSignal(t *testing.T) {
+	require := require.New(t)
+	backend := newFakeBackend()
+	backend.spawn(3, fakeNever)
+	backend.spawn(4, 0)
+
+	// forward the signal as the CLI does.  The exited process is ignored.
+	pidFiles, result, err := SetupPidFiles(backend, targetsOf(3, 4), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.EqualValues(0, result.Pid)
+	require.NoError(SignalPidFiles(pidFiles, syscall.SIGTERM))
+	require.Equal([]unix.Signal{syscall.SIGTERM}, backend.signals(3))
+	require.Empty(backend.signals(4))
+	for _, pidFile := range pidFiles {
+		require.NoError(pidFile.Close())
+	}
+
+	// interrupt waiting
+	pidFiles, result, err = SetupPidFiles(backend, targetsOf(3), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.EqualValues(0, result.Pid)
+	waitCtx, cancel := context.WithCancelCause(context.Background())
+	cancel(SignalErr(syscall.SIGTERM))
+	result, err = WaitForPidFile(waitCtx, pidFiles)
+	require.EqualValues(0, result.Pid)
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), exitErr.ExitCode)
+
+	// pid files are closed, which signalling ignores
+	require.NoError(SignalPidFiles(pidFiles, syscall.SIGTERM))
+	require.Len(backend.signals(3), 1)
+}
+
+func TestSetupParentPidFile(t *testing.T) {
+	require := require.New(t)
+
+	pidFile, result := SetupParentPidFile(PidfdBackend)
+	require.EqualValues(0, result.Pid)
+	require.Equal(os.Getppid(), pidFile.Pid())
+
+	// the test runner is still running
+	waitCtx, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	result, err := WaitForPidFile(waitCtx, []PidFile{pidFile})
+	require.ErrorIs(err, TimeoutErr)
+	require.EqualValues(0, result.Pid)
+}
+
+func TestStreamPidFiles(t *testing.T) {
+	require := require.New(t)
+
+	// all complete, in completion order
+	{
+		backend := newFakeBackend()
+		backend.spawn(3, 10)
+		backend.spawn(4, 5)
+		pidFiles, notFound, err := SetupAllPidFiles(backend, targetsOf(3, 4))
 		require.NoError(err)
-		require.EqualValues(cmd1.Process.Pid, retPid)
+		require.Empty(notFound)
 
-		// cmd2 should still be running
-		err = cmd2.Process.Signal(syscall.Signal(0))
+		results := make(chan ResultPid, 2)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- StreamPidFiles(context.Background(), pidFiles,
+				func(result Result) { results <- result.Pid })
+		}()
+		backend.advance(5)
+		require.EqualValues(4, <-results)
+		backend.advance(10)
+		require.EqualValues(3, <-results)
+		require.NoError(<-errChan)
+	}
+
+	// timeout after some complete
+	{
+		backend := newFakeBackend()
+		backend.spawn(3, fakeNever)
+		backend.spawn(4, 5)
+		pidFiles, _, err := SetupAllPidFiles(backend, targetsOf(3, 4))
 		require.NoError(err)
+
+		waitCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results := make(chan ResultPid, 2)
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- StreamPidFiles(waitCtx, pidFiles,
+				func(result Result) { results <- result.Pid })
+		}()
+		backend.advance(5)
+		require.EqualValues(4, <-results)
+		cancel()
+		require.ErrorIs(<-errChan, TimeoutErr)
+		require.Empty(results)
+	}
+}
+
+func TestSetupPidFilesThread(t *testing.T) {
+	require := require.New(t)
+
+	// a thread of this process other than the main thread
+	tid, release := testutil.StartThread(t)
+
+	// a thread id is not a process
+	_, _, err := SetupPidFiles(PidfdBackend, targetsOf(tid), UNKNOWN_ERROR)
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	require.Equal(INPUT_ERROR, exitErr.ExitCode)
+	require.ErrorIs(err, syscalls.ErrNotThreadGroupLeader)
+
+	pidFiles, result, err := SetupPidFiles(PidfdBackend,
+		[]Target{{Pid: tid, Thread: true}}, UNKNOWN_ERROR)
+	if errors.Is(err, syscalls.ErrThreadUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	require.Zero(result)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = WaitForPidFile(ctx, pidFiles)
+	require.ErrorIs(err, TimeoutErr)
+
+	pidFiles, _, err = SetupPidFiles(PidfdBackend, []Target{{Pid: tid, Thread: true}}, UNKNOWN_ERROR)
+	require.NoError(err)
+	release()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err = WaitForPidFile(ctx, pidFiles)
+	require.NoError(err)
+	require.Equal(ResultPid(tid), result.Pid)
+}
+
+func TestTranslateTargets(t *testing.T) {
+	require := require.New(t)
+
+	procCtx, procCancel := context.WithCancel(context.Background())
+	defer procCancel()
+	cmd, err := createTestSleep(procCtx, "10")
+	require.NoError(err)
+	pid := cmd.Process.Pid
+
+	// our own namespace translates pids to themselves
+	targets := targetsOf(pid, 1<<30)
+	require.NoError(TranslateTargets(targets, PidNamespacePath(strconv.Itoa(os.Getpid()))))
+	require.Equal([]Target{{Pid: pid, NsPid: pid}, {NsPid: 1 << 30}}, targets)
+	require.Equal(ResultPid(1<<30), targets[1].resultPid())
+
+	pidFiles, result, err := SetupPidFiles(PidfdBackend, targets, UNKNOWN_ERROR)
+	require.Nil(pidFiles)
+	require.Equal(ResultPid(1<<30), result.Pid)
+	require.ErrorIs(err, ProcessNotFoundErr)
+
+	pidFiles, result, err = SetupPidFiles(PidfdBackend, targets[:1], UNKNOWN_ERROR)
+	require.NoError(err)
+	require.Zero(result)
+	for _, pidFile := range pidFiles {
+		require.NoError(pidFile.Close())
+	}
+
+	err = TranslateTargets(targetsOf(pid), "/does-not-exist")
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	require.Equal(INPUT_ERROR, exitErr.ExitCode)
+}
+
+func targetsOf(pids ...int) []Target {
+	targets := make([]Target, len(pids))
+	for i, pid := range pids {
+		targets[i] = Target{Pid: pid}
 	}
+	return targets
+}
+
+// the pids of results, nil if there are none
+func pidsOf(results []Result) []ResultPid {
+	var pids []ResultPid
+	for _, result := range results {
+		pids = append(pids, result.Pid)
+	}
+	return pids
 }
 
 // need to set duration
@@ -172,3 +420,217 @@ func createTestSleep(ctx context.Context, sleepDuration string) (*exec.Cmd, erro
 	err := cmd.Start()
 	return cmd, err
 }
+
+func TestStartTimings(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	pidFile, err := PidfdBackend.Open(cmd.Process.Pid, false)
+	require.NoError(err)
+	defer pidFile.Close()
+	timings := StartTimings([]PidFile{pidFile})
+	require.Len(timings, 1)
+	timing := timings[cmd.Process.Pid]
+	require.NotNil(timing)
+	// start time resolution is 10ms
+	require.WithinDuration(time.Now(), timing.Start, time.Second)
+
+	time.Sleep(100 * time.Millisecond)
+	timing.Exited()
+	require.GreaterOrEqual(timing.Elapsed(), 80*time.Millisecond)
+	require.Less(timing.Elapsed(), time.Second)
+	require.False(timing.Exit.Before(timing.Start))
+}
+
+func TestSampleUsage(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	require.NoError(cmd.Start())
+	pidFile, err := PidfdBackend.Open(cmd.Process.Pid, false)
+	require.NoError(err)
+	defer pidFile.Close()
+
+	sampler := SampleUsage([]PidFile{pidFile}, 10*time.Millisecond)
+	defer sampler.Stop()
+	usage, ok := sampler.Last(cmd.Process.Pid)
+	require.True(ok)
+	require.Positive(usage.MaxRSSKiB)
+
+	// samples stop once the process exits, keeping the last
+	require.NoError(cmd.Process.Kill())
+	require.Error(cmd.Wait())
+	time.Sleep(50 * time.Millisecond)
+	_, ok = sampler.Last(cmd.Process.Pid)
+	require.True(ok)
+	_, ok = sampler.Last(1 << 30)
+	require.False(ok)
+}
+
+func TestWatchExits(t *testing.T) {
+	require := require.New(t)
+
+	exit7 := exec.Command("sh", "-c", "exit 7")
+	killed := exec.Command("sleep", "10")
+	require.NoError(killed.Start())
+	// exit7 is started after subscribing and so its pid is not yet known;
+	// watch killed and an unknown pid
+	watcher, err := WatchExits([]int{killed.Process.Pid, 1 << 30})
+	if errors.Is(err, unix.EPERM) ||
+		errors.Is(err, syscalls.ErrProcConnectorNoAck) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	defer watcher.Stop()
+	require.NoError(exit7.Start())
+	require.Error(exit7.Wait())
+
+	require.NoError(killed.Process.Signal(syscall.SIGTERM))
+	require.Error(killed.Wait())
+	code, ok := watcher.ExitCode(killed.Process.Pid)
+	require.True(ok)
+	require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), code)
+	code, ok = watcher.ReportedExitCode(killed.Process.Pid)
+	require.True(ok)
+	require.Equal(SIGNAL_EXIT_BASE+int(syscall.SIGTERM), code)
+
+	_, ok = watcher.ExitCode(exit7.Process.Pid)
+	require.False(ok)
+	_, ok = watcher.ExitCode(1 << 30)
+	require.False(ok)
+
+	// without waiting for the exit to be reported
+	start := time.Now()
+	_, ok = watcher.ReportedExitCode(1 << 30)
+	require.False(ok)
+	require.Less(time.Since(start), exitEventTimeout)
+}
+
+// a thread other than the leader exiting is not a process exit
+func TestWatchExitsThread(t *testing.T) {
+	require := require.New(t)
+
+	tid, release := testutil.StartThread(t)
+	watcher, err := WatchExits([]int{tid})
+	if errors.Is(err, unix.EPERM) ||
+		errors.Is(err, syscalls.ErrProcConnectorNoAck) {
+		t.Skip(err)
+	}
+	require.NoError(err)
+	defer watcher.Stop()
+	release()
+	_, ok := watcher.ExitCode(tid)
+	require.False(ok)
+}
+
+func TestWaitForEvent(t *testing.T) {
+	require := require.New(t)
+
+	// exec'ing a new program
+	execs := exec.Command("sh", "-c", "sleep 0.1; exec sleep 10")
+	require.NoError(execs.Start())
+	defer execs.Wait()
+	defer execs.Process.Kill()
+	// exiting without exec'ing
+	exits := exec.Command("sh", "-c", "sleep 0.2; exit 0")
+	require.NoError(exits.Start())
+	defer exits.Wait()
+
+	pidFiles, _, err := SetupPidFiles(PidfdBackend,
+		targetsOf(execs.Process.Pid, exits.Process.Pid), UNKNOWN_ERROR)
+	require.NoError(err)
+	var results []string
+	err = StreamEvents(context.Background(), pidFiles, 10*time.Millisecond,
+		func(result Result, event Event) {
+			results = append(results, fmt.Sprint(result.Pid, " ", event, " ",
+				result.State))
+		})
+	require.NoError(err)
+	// exits is not reaped until the test ends
+	require.Equal([]string{
+		strconv.Itoa(execs.Process.Pid) + " exec running",
+		strconv.Itoa(exits.Process.Pid) + " exit zombie"}, results)
+
+	pidFiles, _, err = SetupPidFiles(PidfdBackend, targetsOf(execs.Process.Pid), UNKNOWN_ERROR)
+	require.NoError(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = WaitForEvent(ctx, pidFiles, 10*time.Millisecond)
+	require.ErrorIs(err, TimeoutErr)
+}
+
+func TestPollExecs(t *testing.T) {
+	require := require.New(t)
+
+	cmd := exec.Command("sh", "-c", "sleep 0.1; exec sleep 10")
+	require.NoError(cmd.Start())
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	pidFile, err := PidfdBackend.Open(cmd.Process.Pid, false)
+	require.NoError(err)
+	defer pidFile.Close()
+
+	c := make(chan eventResult, 1)
+	stopChan := make(chan struct{})
+	go pollExecs([]PidFile{pidFile}, 10*time.Millisecond, stopChan, c)
+	defer close(stopChan)
+	select {
+	case result := <-c:
+		require.Equal(eventResult{
+			pid: ResultPid(cmd.Process.Pid), event: EVENT_EXEC}, result)
+	case <-time.After(5 * time.Second):
+		require.Fail("exec not polled")
+	}
+}
+
+func TestPollPidFiles(t *testing.T) {
+	require := require.New(t)
+	backend := newFakeBackend()
+	backend.spawn(3, fakeNever)
+	backend.spawn(4, 0)
+	backend.spawn(5, 0)
+
+	pidFiles, _, err := SetupPidFiles(backend, targetsOf(3, 5, 4), UNKNOWN_ERROR)
+	require.NoError(err)
+	require.Equal([]ResultPid{5, 4}, pidsOf(PollPidFiles(pidFiles)))
+	for _, pidFile := range pidFiles {
+		_, err := pidFile.Done()
+		require.ErrorIs(err, os.ErrClosed)
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	require := require.New(t)
+
+	// already exited, without waiting
+	{
+		backend := newFakeBackend()
+		backend.spawn(3, fakeNever)
+		backend.spawn(4, 0)
+		backend.spawn(5, 0)
+		pidFiles, _, err := SetupPidFiles(backend, targetsOf(3, 5, 4), UNKNOWN_ERROR)
+		require.NoError(err)
+		ready, err := WaitForReady(context.Background(), pidFiles)
+		require.NoError(err)
+		require.Equal([]ResultPid{5, 4}, pidsOf(ready))
+	}
+
+	// every process exited by the time the first wakes waiting
+	{
+		backend := newFakeBackend()
+		backend.spawn(3, fakeNever)
+		backend.spawn(4, 5)
+		backend.spawn(5, 5)
+		backend.spawn(6, 10)
+		pidFiles, _, err := SetupPidFiles(backend, targetsOf(3, 6, 5, 4), UNKNOWN_ERROR)
+		require.NoError(err)
+		go backend.advance(5)
+		ready, err := WaitForReady(context.Background(), pidFiles)
+		require.NoError(err)
+		require.Equal([]ResultPid{5, 4}, pidsOf(ready))
+	}
+}
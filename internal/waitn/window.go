@@ -0,0 +1,333 @@
+package waitn
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stevenpelley/waitn/internal/syscalls"
+	"golang.org/x/sys/unix"
+)
+
+// file descriptors left for other uses when sizing a window to the limit on
+// open files: standard streams, reading /proc, and commands run by
+// subcommands.  At most half the limit is reserved.
+const windowFdReserve = 128
+
+// pids outside a window are polled at an interval doubling from pollMinInterval
+// to this.  It is longer than PollBackend's as very many pids may be polled.
+const overflowPollMaxInterval = time.Second
+
+// a backend opening pid files with primary, such as pidfds costing a file
+// descriptor each, for a window of at most a number of pids at a time.  Pids
+// beyond the window, or for which primary fails with EMFILE or ENFILE, are
+// instead checked with overflow, such as by polling /proc, and rotated into the
+// window in the order they block as slots free.  A slot frees once its process
+// completes or its pid file closes.
+type windowBackend struct {
+	primary  Backend
+	overflow Backend
+	// the number of slots, called once when first opening a pid file
+	size            func() int
+	sizeOnce        sync.Once
+	pollMaxInterval time.Duration
+	mu              sync.Mutex
+	free            int
+	// overflowing pid files waiting to be handed a slot.  Those no longer
+	// waiting are skipped.
+	waiters []*windowPidFile
+}
+
+func newWindowBackend(primary Backend, overflow Backend,
+	size func() int) *windowBackend {
+	return &windowBackend{
+		primary:         primary,
+		overflow:        overflow,
+		size:            size,
+		pollMaxInterval: overflowPollMaxInterval}
+}
+
+// the size of a window of pidfds within the limit on open files, first raising
+// its soft limit to the hard limit
+func fileLimitWindow() int {
+	limit, err := syscalls.RaiseFileLimit()
+	if err != nil {
+		panic(err)
+	}
+	if limit > 1<<31 {
+		limit = 1 << 31
+	}
+	return int(limit - min(windowFdReserve, limit/2))
+}
+
+// take a free slot without waiting
+func (b *windowBackend) take() bool {
+	b.sizeOnce.Do(func() { b.free = b.size() })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.free == 0 {
+		return false
+	}
+	b.free--
+	return true
+}
+
+// take a slot handed to f or a free slot, or else queue f to be handed one as
+// slots free.  f is woken once handed a slot.
+func (b *windowBackend) takeOrWait(f *windowPidFile) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if f.granted {
+		f.granted = false
+		return true
+	}
+	if b.free > 0 {
+		b.free--
+		f.waiting = false
+		return true
+	}
+	if !f.waiting {
+		f.waiting = true
+		b.waiters = append(b.waiters, f)
+	}
+	return false
+}
+
+// stop f waiting for a slot, releasing any it was handed
+func (b *windowBackend) stopWaiting(f *windowPidFile) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f.waiting = false
+	if f.granted {
+		f.granted = false
+		b.releaseLocked()
+	}
+}
+
+// free a slot, handing it to the first waiting pid file
+func (b *windowBackend) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.releaseLocked()
+}
+
+func (b *windowBackend) releaseLocked() {
+	for len(b.waiters) > 0 {
+		f := b.waiters[0]
+		b.waiters[0] = nil
+		b.waiters = b.waiters[1:]
+		if f.waiting {
+			f.waiting = false
+			f.granted = true
+			select {
+			case f.wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+	b.free++
+}
+
+func (b *windowBackend) Open(pid int, thread bool) (PidFile, error) {
+	f := &windowPidFile{
+		backend: b,
+		pid:     pid,
+		thread:  thread,
+		closedC: make(chan struct{}),
+		wake:    make(chan struct{}, 1)}
+	if b.take() {
+		pidFile, err := b.primary.Open(pid, thread)
+		if err == nil {
+			f.primary = pidFile
+			return f, nil
+		}
+		b.release()
+		if !errors.Is(err, unix.EMFILE) && !errors.Is(err, unix.ENFILE) {
+			return nil, err
+		}
+	}
+	pidFile, err := b.overflow.Open(pid, thread)
+	if err != nil {
+		return nil, err
+	}
+	f.overflow = pidFile
+	return f, nil
+}
+
+// a pid file of a windowBackend, opened by either its primary or overflow
+// backend until its process completes or it closes
+type windowPidFile struct {
+	backend *windowBackend
+	pid     int
+	thread  bool
+	mu      sync.Mutex
+	primary PidFile
+	// closed once rotated into the window
+	overflow PidFile
+	done     bool
+	closed   bool
+	closedC  chan struct{}
+	// guarded by backend.mu
+	waiting bool
+	granted bool
+	wake    chan struct{}
+}
+
+func (f *windowPidFile) Pid() int {
+	return f.pid
+}
+
+// close the open pid file once the process completes, freeing its slot.  f.mu
+// must be held.
+func (f *windowPidFile) finishLocked() error {
+	f.done = true
+	if f.primary != nil {
+		err := f.primary.Close()
+		f.primary = nil
+		f.backend.release()
+		return err
+	}
+	err := f.overflow.Close()
+	f.overflow = nil
+	return err
+}
+
+// move an overflowing pid file into the window, given a slot.  The slot is
+// freed if the process has completed.  If the primary backend is out of file
+// descriptors the slot is dropped, shrinking the window.
+func (f *windowPidFile) rotateIn() error {
+	pidFile, err := f.backend.primary.Open(f.pid, f.thread)
+	if errors.Is(err, unix.EMFILE) || errors.Is(err, unix.ENFILE) {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	done := errors.Is(err, unix.ESRCH)
+	if err != nil && !done {
+		f.backend.release()
+		return err
+	}
+	if f.closed || f.done {
+		f.backend.release()
+		if pidFile != nil {
+			return pidFile.Close()
+		}
+		return nil
+	}
+	if !done {
+		// the pid file refers to our process, not one reusing its pid, if
+		// ours has not completed since it was opened
+		done, err = f.overflow.Done()
+		if err != nil || done {
+			f.backend.release()
+			if err := errors.Join(err, pidFile.Close()); err != nil {
+				return err
+			}
+			return f.finishLocked()
+		}
+		f.primary = pidFile
+		err = f.overflow.Close()
+		f.overflow = nil
+		return err
+	}
+	f.backend.release()
+	return f.finishLocked()
+}
+
+// Outside the window the process is polled until it completes or f is handed a
+// slot.
+func (f *windowPidFile) BlockUntilDoneOrClosed() error {
+	defer f.backend.stopWaiting(f)
+	interval := pollMinInterval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		f.mu.Lock()
+		primary, done, closed := f.primary, f.done, f.closed
+		f.mu.Unlock()
+		if closed {
+			return os.ErrClosed
+		} else if done {
+			return nil
+		}
+
+		if primary != nil {
+			// closed if another goroutine found the process completed
+			err := primary.BlockUntilDoneOrClosed()
+			if err != nil && !errors.Is(err, os.ErrClosed) {
+				return err
+			}
+		} else if f.backend.takeOrWait(f) {
+			if err := f.rotateIn(); err != nil {
+				return err
+			}
+			continue
+		} else {
+			select {
+			case <-f.closedC:
+				continue
+			case <-f.wake:
+				continue
+			case <-timer.C:
+				timer.Reset(interval)
+				interval = min(2*interval, f.backend.pollMaxInterval)
+			}
+		}
+		if _, err := f.Done(); err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+	}
+}
+
+func (f *windowPidFile) Done() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false, os.ErrClosed
+	} else if f.done {
+		return true, nil
+	}
+	pidFile := f.primary
+	if pidFile == nil {
+		pidFile = f.overflow
+	}
+	done, err := pidFile.Done()
+	if err != nil || !done {
+		return false, err
+	}
+	return true, f.finishLocked()
+}
+
+func (f *windowPidFile) SendSignal(sig unix.Signal) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	} else if f.done {
+		return unix.ESRCH
+	} else if f.primary != nil {
+		return f.primary.SendSignal(sig)
+	}
+	return f.overflow.SendSignal(sig)
+}
+
+func (f *windowPidFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	close(f.closedC)
+	var err error
+	if f.primary != nil {
+		err = f.primary.Close()
+		f.backend.release()
+	} else if f.overflow != nil {
+		err = f.overflow.Close()
+	}
+	f.backend.stopWaiting(f)
+	return err
+}
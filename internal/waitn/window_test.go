@@ -0,0 +1,82 @@
+package waitn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func inWindow(pidFile PidFile) bool {
+	f := pidFile.(*windowPidFile)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.primary != nil
+}
+
+func freeSlots(b *windowBackend) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.free
+}
+
+func TestWindowBackend(t *testing.T) {
+	require := require.New(t)
+
+	fake := newFakeBackend()
+	fake.spawn(3, 1)
+	fake.spawn(4, 2)
+	fake.spawn(5, 3)
+	backend := newWindowBackend(fake, fake, func() int { return 1 })
+	backend.pollMaxInterval = time.Millisecond
+
+	pidFiles, _, err := SetupAllPidFiles(backend, targetsOf(3, 4, 5))
+	require.NoError(err)
+	require.True(inWindow(pidFiles[0]))
+	require.False(inWindow(pidFiles[1]))
+	require.False(inWindow(pidFiles[2]))
+
+	results := make(chan ResultPid, 3)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StreamPidFiles(context.Background(), pidFiles,
+			func(result Result) { results <- result.Pid })
+	}()
+
+	// slots free as processes complete and are handed to polled pids
+	fake.advance(1)
+	require.EqualValues(3, <-results)
+	require.Eventually(func() bool {
+		return inWindow(pidFiles[1]) || inWindow(pidFiles[2])
+	}, 5*time.Second, time.Millisecond)
+	fake.advance(2)
+	require.EqualValues(4, <-results)
+	require.Eventually(func() bool { return inWindow(pidFiles[2]) },
+		5*time.Second, time.Millisecond)
+	require.Zero(freeSlots(backend))
+	fake.advance(3)
+	require.EqualValues(5, <-results)
+	require.NoError(<-errChan)
+	require.Equal(1, freeSlots(backend))
+
+	// pids are polled when the primary backend is out of file descriptors
+	primary := newFakeBackend()
+	primary.failOpen(6, unix.EMFILE)
+	overflow := newFakeBackend()
+	overflow.spawn(6, 0)
+	backend = newWindowBackend(primary, overflow, func() int { return 1 })
+	pidFiles, _, err = SetupAllPidFiles(backend, targetsOf(6))
+	require.NoError(err)
+	require.False(inWindow(pidFiles[0]))
+	require.Equal(1, freeSlots(backend))
+	require.Equal([]ResultPid{6}, pidsOf(PollPidFiles(pidFiles)))
+
+	// other backends fail
+	_, _, err = SetupAllPidFiles(primary, targetsOf(6))
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	require.Equal(INPUT_ERROR, exitErr.ExitCode)
+	require.ErrorIs(err, unix.EMFILE)
+}
@@ -17,28 +17,33 @@ create_temp() {
 }
 
 # intended to match bash's "wait -n -p VARNAME pids..."
-# do not pass "-n" flag
+# do not pass "-n" flag.  -l VARNAME additionally assigns the label of a pid
+# passed as <label>=<pid>, or the empty string if it has none.
 #
 # note that we must take care with namerefs and locals.  If the "pid_var_name"
 # passed to us aliases with any local var here then we end up setting the local
 # instead of a global.
 #
 # all local variables will be prefixed with _waitn_.  The caller must not pass
-# such a variable with -p and doing so will result in an error.
+# such a variable with -p or -l and doing so will result in an error.
 #
 # rename this if the waitn command is in PATH
 waitn() {
-    # parse out any -p option
+    # parse out any -p and -l options
     local _waitn_pid_var_name
-    if [ "$1" = "-p" ]; then
-        _waitn_pid_var_name="$2"
-        if [[ $myvar =~ ^_waitn_ ]]; then
-            echo "-p varname begins with _waitn_.  Such names are restricted to prevent nameref collisions.  Use a different name"
+    local _waitn_label_var_name
+    while [ "$1" = "-p" ] || [ "$1" = "-l" ]; do
+        if [[ $2 =~ ^_waitn_ ]]; then
+            echo "$1 varname begins with _waitn_.  Such names are restricted to prevent nameref collisions.  Use a different name"
             exit 1
         fi
-        unset -n _waitn_pid_var_name
+        if [ "$1" = "-p" ]; then
+            _waitn_pid_var_name="$2"
+        else
+            _waitn_label_var_name="$2"
+        fi
         shift 2
-    fi
+    done
 
     create_temp _waitn_out_fd _waitn_in_fd
 
@@ -53,7 +58,10 @@ waitn() {
         # waitn completed
 
         # get the exit code of the returned pid
-        local _waitn_pid=$(wait_cmd_get_pid <&$_waitn_in_fd)
+        local _waitn_line
+        read -r _waitn_line <&$_waitn_in_fd
+        local _waitn_pid=$(wait_cmd_get_pid <<< "$_waitn_line")
+        local _waitn_label=$(wait_cmd_get_label <<< "$_waitn_line")
         exec {_waitn_out_fd}>&-
         exec {_waitn_in_fd}>&-
 
@@ -65,6 +73,10 @@ waitn() {
             local -g -n _waitn_pid_var_ref="$_waitn_pid_var_name"
             _waitn_pid_var_ref="$_waitn_pid"
         fi
+        if [ -n "$_waitn_label_var_name" ]; then
+            local -g -n _waitn_label_var_ref="$_waitn_label_var_name"
+            _waitn_label_var_ref="$_waitn_label"
+        fi
 
         # wait returns the exit code of the awaited process, which is the exit
         # code of the wait builtin
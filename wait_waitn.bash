@@ -1,11 +1,22 @@
 #!/usr/bin/env bash
 SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd )
 
+# runs the waitn binary next to this script, or $WAITN if set
 wait_cmd() {
-    local _waitn_path=$(realpath "$SCRIPT_DIR/waitn")
+    local _waitn_path=${WAITN:-$(realpath "$SCRIPT_DIR/waitn")}
     "$_waitn_path" $@
 }
 
+# waitn prints "<label> <pid>" for labelled pids; the pid is always last
 wait_cmd_get_pid() {
-    cat
+    local _waitn_line
+    read -r _waitn_line
+    echo "${_waitn_line##* }"
+}
+
+# the label of a labelled pid, or nothing
+wait_cmd_get_label() {
+    local _waitn_line
+    read -r _waitn_line
+    [[ $_waitn_line == *" "* ]] && echo "${_waitn_line% *}"
 }
\ No newline at end of file